@@ -0,0 +1,176 @@
+package minidb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sequenceFile is the hidden file, inside a collection's directory, holding
+// the last ID handed out by Append.
+const sequenceFile = ".sequence"
+
+// idDigits is the width IDs are zero-padded to, enough for any uint64, so
+// that they sort by name in the order they were handed out.
+const idDigits = 20
+
+// Append writes v to a collection, like Write, under a new ID one above the
+// last one handed out for it, and returns that ID. IDs are zero-padded so
+// ReadAll and ReadRange return appended records in order. The last ID is kept
+// in the collection, so IDs keep increasing across restarts and aren't reused
+// after deletes, though a failed Append may leave a gap.
+func (d *Driver) Append(collection string, v interface{}) (string, error) {
+	if d.closed.Load() {
+		return "", ErrClosed
+	}
+
+	if d.readOnly {
+		return "", ErrReadOnly
+	}
+
+	if collection == "" {
+		return "", missingName("Missing collection - no place to append record!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return "", err
+	}
+
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	// Handing out IDs needs the collection to itself, even with RecordLocks.
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	if err := d.fs.MkdirAll(dir, d.dirPerm); err != nil {
+		return "", err
+	}
+
+	last, err := d.lastID(collection)
+	if err != nil {
+		return "", err
+	}
+
+	id := fmt.Sprintf("%0*d", idDigits, last+1)
+
+	// The ID is taken before the record is written, so a crash in between
+	// can't hand it out twice.
+	if err := d.writeFile(filepath.Join(dir, sequenceFile), []byte(id+"\n")); err != nil {
+		return "", err
+	}
+
+	b, err := d.store(collection, id, v, d.ttl)
+	if err != nil {
+		return "", err
+	}
+
+	pending.write(collection, id, b)
+
+	return id, nil
+}
+
+// lastID returns the last ID Append handed out in the collection. Collections
+// without a sequence file yet, such as ones written to by hand, start after
+// the highest ID among their records.
+func (d *Driver) lastID(collection string) (uint64, error) {
+	dir := filepath.Join(d.dir, collection)
+
+	b, err := d.fs.ReadFile(filepath.Join(dir, sequenceFile))
+	if err == nil {
+		last, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %w", sequenceFile, err)
+		}
+
+		return last, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	files, err := d.collectionFiles(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var last uint64
+
+	for _, file := range files {
+		if !d.isRecordName(collection, filepath.Base(file)) {
+			continue
+		}
+
+		name := d.recordName(collection, file)
+		if len(name) != idDigits {
+			continue
+		}
+
+		if id, err := strconv.ParseUint(name, 10, 64); err == nil && id > last {
+			last = id
+		}
+	}
+
+	return last, nil
+}
+
+// ReadRange returns the records of a collection named fromID to toID, both
+// included, in name order. An empty fromID or toID leaves that end open. It
+// is meant for collections filled by Append, but works on any.
+func (d *Driver) ReadRange(collection, fromID, toID string) ([]string, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	if collection == "" {
+		return nil, missingName("Missing collection - no place to read records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	if _, err := d.stat(collection, dir); err != nil {
+		return nil, notFound(err)
+	}
+
+	files, err := d.listRecords(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []string{}
+
+	for _, file := range files {
+		name := d.recordName(collection, file)
+
+		if fromID != "" && name < fromID {
+			continue
+		}
+
+		if toID != "" && name > toID {
+			break
+		}
+
+		b, err := d.readFile(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, string(b))
+	}
+
+	return records, nil
+}
@@ -0,0 +1,58 @@
+package minidb
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	dir := t.TempDir()
+	d := newTestDriverAt(t, dir, nil)
+
+	var ids []string
+
+	for i := 1; i <= 3; i++ {
+		id, err := d.Append("events", user{Name: fmt.Sprint(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := fmt.Sprintf("%020d", i); id != want {
+			t.Errorf("Append = %s, want %s", id, want)
+		}
+
+		ids = append(ids, id)
+	}
+
+	// IDs aren't reused after a delete, nor after reopening.
+	if err := d.Delete("events", ids[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Close()
+	d = newTestDriverAt(t, dir, nil)
+
+	id, err := d.Append("events", user{Name: "4"})
+	if want := fmt.Sprintf("%020d", 4); err != nil || id != want {
+		t.Errorf("Append after reopening = %s, %v; want %s", id, err, want)
+	}
+
+	tests := []struct {
+		from, to string
+		want     []string
+	}{
+		{"", "", []string{"1", "2", "4"}},
+		{ids[1], "", []string{"2", "4"}},
+		{"", ids[1], []string{"1", "2"}},
+		{ids[1], ids[1], []string{"2"}},
+		{ids[2], ids[0], nil},
+	}
+
+	for _, tt := range tests {
+		records, err := d.ReadRange("events", tt.from, tt.to)
+		if got := names(t, records); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ReadRange(%s, %s) = %v, %v; want %v", tt.from, tt.to, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package minidb
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Backup streams a gzipped tar of every collection to w. Each collection is
+// read-locked while its files are archived, so every collection is captured in
+// a consistent state, though not necessarily at the same moment as the others.
+// In-flight ".tmp" files are left out.
+func (d *Driver) Backup(w io.Writer) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	collections, err := d.Collections()
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+
+	for _, collection := range collections {
+		if err := d.backupCollection(tw, collection); err != nil {
+			return fmt.Errorf("unable to back up collection %s: %w", collection, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func (d *Driver) backupCollection(tw *tar.Writer, collection string) error {
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	return d.walkDir(filepath.Join(d.dir, collection), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+
+		fi, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(d.dir, path)
+		if err != nil {
+			return err
+		}
+
+		b, err := d.fs.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(rel)
+		hdr.Size = int64(len(b))
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		_, err = tw.Write(b)
+
+		return err
+	})
+}
+
+// Restore extracts a backup made by Backup into the database. Unless force is
+// set, it fails with ErrExists without changing anything if a file of the
+// backup already exists; with force, such files are replaced. Files of the
+// database missing from the backup are left alone either way.
+func (d *Driver) Restore(r io.Reader, force bool) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	// Extract everything aside first, so a corrupt archive or a clash leaves
+	// the database untouched.
+	tmpDir, err := d.mkdirTemp(".restore-")
+	if err != nil {
+		return err
+	}
+	defer d.fs.RemoveAll(tmpDir)
+
+	files, err := d.extract(r, tmpDir)
+	if err != nil {
+		return fmt.Errorf("unable to read backup: %w", err)
+	}
+
+	var collections []string
+
+	for _, file := range files {
+		collections = append(collections, strings.SplitN(file, string(filepath.Separator), 2)[0])
+	}
+
+	unlock := d.lockCollections(collections...)
+	defer unlock()
+
+	if !force {
+		for _, file := range files {
+			if _, err := d.fs.Stat(filepath.Join(d.dir, file)); err == nil {
+				return fmt.Errorf("unable to restore %s: %w", filepath.ToSlash(file), ErrExists)
+			}
+		}
+	}
+
+	for _, collection := range collections {
+		d.cache.removeCollection(collection)
+		d.schemas.Delete(collection)
+		d.forgetIndexes(collection)
+	}
+
+	for _, file := range files {
+		path := filepath.Join(d.dir, file)
+
+		if err := d.fs.MkdirAll(filepath.Dir(path), d.dirPerm); err != nil {
+			return err
+		}
+
+		if err := d.fs.Rename(filepath.Join(tmpDir, file), path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extract unpacks a gzipped tar into dir and returns the paths of the files
+// it held, relative to dir. Entries that would land outside of a collection
+// are rejected.
+func (d *Driver) extract(r io.Reader, dir string) ([]string, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+
+	var files []string
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		name := filepath.FromSlash(hdr.Name)
+		parts := strings.Split(name, string(filepath.Separator))
+
+		if hdr.Typeflag != tar.TypeReg || !filepath.IsLocal(name) || len(parts) < 2 || strings.HasPrefix(parts[0], ".") {
+			return nil, fmt.Errorf("unexpected entry %q", hdr.Name)
+		}
+
+		path := filepath.Join(dir, name)
+
+		if err := d.fs.MkdirAll(filepath.Dir(path), d.dirPerm); err != nil {
+			return nil, err
+		}
+
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := d.fs.WriteFile(path, b, d.filePerm); err != nil {
+			return nil, err
+		}
+
+		files = append(files, name)
+	}
+}
+
+// lockCollections locks every given collection in name order, so that
+// concurrent callers locking overlapping collections can't deadlock, and
+// returns the func that unlocks them.
+func (d *Driver) lockCollections(collections ...string) func() {
+	return d.lockSorted(false, collections)
+}
+
+// rlockCollections is lockCollections taking read locks.
+func (d *Driver) rlockCollections(collections ...string) func() {
+	return d.lockSorted(true, collections)
+}
+
+func (d *Driver) lockSorted(read bool, collections []string) func() {
+	names := append([]string(nil), collections...)
+	sort.Strings(names)
+
+	var mutexes []*sync.RWMutex
+
+	for i, name := range names {
+		if i > 0 && name == names[i-1] {
+			continue
+		}
+
+		mutex := d.getOrCreateMutex(name)
+
+		if read {
+			mutex.RLock()
+		} else {
+			mutex.Lock()
+		}
+
+		mutexes = append(mutexes, mutex)
+	}
+
+	return func() {
+		for _, mutex := range mutexes {
+			if read {
+				mutex.RUnlock()
+			} else {
+				mutex.Unlock()
+			}
+		}
+	}
+}
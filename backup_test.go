@@ -0,0 +1,121 @@
+package minidb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	src := newTestDriver(t, &Options{ShardDepth: 1})
+
+	if err := src.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := src.Write("orders", "1", user{Name: "order"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := src.AddUniqueIndex("users", "Name"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(src.dir, "users", "x.json.tmp"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var backup bytes.Buffer
+	if err := src.Backup(&backup); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := newTestDriver(t, &Options{ShardDepth: 1})
+
+	if err := dst.Restore(bytes.NewReader(backup.Bytes()), false); err != nil {
+		t.Fatal(err)
+	}
+
+	var u user
+	if err := dst.Read("users", "john", &u); err != nil || u.Name != "john" {
+		t.Errorf("restored users/john = %+v, %v", u, err)
+	}
+
+	if err := dst.Read("orders", "1", &u); err != nil || u.Name != "order" {
+		t.Errorf("restored orders/1 = %+v, %v", u, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dst.dir, "users", "x.json.tmp")); !os.IsNotExist(err) {
+		t.Errorf(".tmp file was backed up: %v", err)
+	}
+
+	// The unique index came along.
+	if err := dst.Write("users", "johnny", user{Name: "john"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("Write after Restore = %v, want ErrUniqueViolation", err)
+	}
+
+	if err := dst.Write("users", "john", user{Name: "changed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dst.Restore(bytes.NewReader(backup.Bytes()), false); !errors.Is(err, ErrExists) {
+		t.Errorf("Restore over existing records = %v, want ErrExists", err)
+	}
+
+	if err := dst.Read("users", "john", &u); err != nil || u.Name != "changed" {
+		t.Errorf("a failed Restore changed users/john to %+v, %v", u, err)
+	}
+
+	if err := dst.Restore(bytes.NewReader(backup.Bytes()), true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dst.Read("users", "john", &u); err != nil || u.Name != "john" {
+		t.Errorf("forced Restore left users/john at %+v, %v", u, err)
+	}
+}
+
+func TestRestoreRejectsBadArchives(t *testing.T) {
+	archive := func(name string, typeflag byte) []byte {
+		var buf bytes.Buffer
+
+		zw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(zw)
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: typeflag, Mode: 0644, Size: 2})
+		tw.Write([]byte("{}"))
+		tw.Close()
+		zw.Close()
+
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{"not gzip", []byte("garbage")},
+		{"escaping", archive("../evil/x.json", tar.TypeReg)},
+		{"absolute", archive("/evil/x.json", tar.TypeReg)},
+		{"outside a collection", archive("x.json", tar.TypeReg)},
+		{"hidden directory", archive(".restore-1/x.json", tar.TypeReg)},
+		{"symlink", archive("users/x.json", tar.TypeSymlink)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDriver(t, nil)
+
+			if err := d.Restore(bytes.NewReader(tt.archive), true); err == nil {
+				t.Error("Restore accepted the archive")
+			}
+
+			if collections, _ := d.Collections(); len(collections) > 0 {
+				t.Errorf("a rejected Restore left %v behind", collections)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package minidb
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func BenchmarkWrite(b *testing.B) {
+	d := newTestDriver(b, nil)
+	u := user{Name: "john", Age: 30, Company: "Acme", State: "NY"}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := d.Write("users", fmt.Sprint(i%1000), u); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	d := newTestDriver(b, nil)
+
+	for i := 0; i < 1000; i++ {
+		if err := d.Write("users", fmt.Sprint(i), user{Name: fmt.Sprint(i)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var u user
+		if err := d.Read("users", fmt.Sprint(i%1000), &u); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadAll(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			d := newTestDriver(b, nil)
+
+			for i := 0; i < n; i++ {
+				if err := d.Write("users", fmt.Sprint(i), user{Name: fmt.Sprint(i)}); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := d.ReadAll("users"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkParallelWrite compares concurrent writes to different records of
+// one collection under the collection lock with RecordLocks.
+func BenchmarkParallelWrite(b *testing.B) {
+	for _, bm := range []struct {
+		name        string
+		recordLocks bool
+	}{
+		{"CollectionLock", false},
+		{"RecordLocks", true},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			d := newTestDriver(b, &Options{RecordLocks: bm.recordLocks})
+			u := user{Name: "john", Age: 30, Company: "Acme", State: "NY"}
+
+			var next atomic.Int64
+
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				resource := fmt.Sprint(next.Add(1))
+
+				for pb.Next() {
+					if err := d.Write("users", resource, u); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkKeys compares listing a collection with its records in one
+// directory and spread over shard directories.
+func BenchmarkKeys(b *testing.B) {
+	for _, depth := range []int{0, 1, 2} {
+		b.Run(fmt.Sprintf("ShardDepth%d", depth), func(b *testing.B) {
+			d := newTestDriver(b, &Options{ShardDepth: depth})
+
+			for i := 0; i < 1000; i++ {
+				if err := d.Write("users", fmt.Sprint(i), user{Name: fmt.Sprint(i)}); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := d.Keys("users"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package minidb
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// lruCache keeps the most recently read records in memory, keyed by
+// "collection/resource". A nil *lruCache is a valid, always empty cache.
+type lruCache struct {
+	mutex   sync.Mutex
+	size    int
+	clock   Clock
+	order   *list.List
+	entries map[string]*list.Element
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type cacheEntry struct {
+	key     string
+	raw     []byte
+	expires *time.Time
+}
+
+func newLRUCache(size int, clock Clock) *lruCache {
+	if size <= 0 {
+		return nil
+	}
+
+	return &lruCache{
+		size:    size,
+		clock:   clock,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func cacheKey(collection, resource string) string {
+	return collection + "/" + resource
+}
+
+// get returns a copy of the cached record, so callers can't modify the cached
+// bytes through it.
+func (c *lruCache) get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+
+	if entry.expires != nil && !c.clock.Now().Before(*entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	c.hits.Add(1)
+
+	return append([]byte(nil), entry.raw...), true
+}
+
+func (c *lruCache) add(key string, raw []byte, expires *time.Time) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry := &cacheEntry{key: key, raw: append([]byte(nil), raw...), expires: expires}
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *lruCache) remove(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+		delete(c.entries, key)
+	}
+}
+
+// removeCollection drops every cached record of a collection.
+func (c *lruCache) removeCollection(collection string) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	prefix := collection + "/"
+
+	for key, el := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.order.Remove(el)
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package minidb
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestCacheRecordLocksStress races readers filling the cache against writers
+// replacing the records, each writer checking it reads back what it wrote
+// rather than a stale cached record. Run it with -race.
+func TestCacheRecordLocksStress(t *testing.T) {
+	d := newTestDriver(t, &Options{RecordLocks: true, CacheSize: 8})
+
+	const (
+		records = 2
+		writes  = 1000
+		readers = 4
+	)
+
+	var wg sync.WaitGroup
+
+	for r := 0; r < records; r++ {
+		resource := fmt.Sprint("r", r)
+
+		wg.Add(1 + readers)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 1; i <= writes; i++ {
+				if err := d.Write("counters", resource, map[string]int{"n": i}); err != nil {
+					t.Error(err)
+					return
+				}
+
+				var v map[string]int
+				if err := d.Read("counters", resource, &v); err != nil || v["n"] != i {
+					t.Errorf("%s: read n = %d, %v after writing %d", resource, v["n"], err, i)
+					return
+				}
+			}
+		}()
+
+		for j := 0; j < readers; j++ {
+			go func() {
+				defer wg.Done()
+
+				for i := 0; i < writes; i++ {
+					var v map[string]int
+					d.Read("counters", resource, &v)
+				}
+			}()
+		}
+	}
+
+	wg.Wait()
+
+	for r := 0; r < records; r++ {
+		var v map[string]int
+		if err := d.Read("counters", fmt.Sprint("r", r), &v); err != nil {
+			t.Fatal(err)
+		}
+
+		if v["n"] != writes {
+			t.Errorf("r%d: read n = %d from the cache, want %d", r, v["n"], writes)
+		}
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	d := newTestDriver(t, &Options{CacheSize: 2})
+
+	tests := []struct {
+		name   string
+		modify func() error
+		want   int
+		err    bool
+	}{
+		{"write", func() error { return d.Write("users", "john", user{Age: 2}) }, 2, false},
+		{"update", func() error {
+			return d.Update("users", "john", func([]byte) ([]byte, error) { return []byte(`{"Age":3}`), nil })
+		}, 3, false},
+		{"delete", func() error { return d.Delete("users", "john") }, 0, true},
+	}
+
+	if err := d.Write("users", "john", user{Age: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before user
+			d.Read("users", "john", &before)
+
+			if err := tt.modify(); err != nil {
+				t.Fatal(err)
+			}
+
+			var after user
+			err := d.Read("users", "john", &after)
+			if (err != nil) != tt.err || after.Age != tt.want {
+				t.Errorf("after %s: Read = %+v, %v; want Age %d", tt.name, after, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadBytesCopy(t *testing.T) {
+	d := newTestDriver(t, &Options{CacheSize: 8})
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := d.ReadBytes("users", "john")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Scribbling over the returned bytes must not reach the cached record.
+	want := bytes.Clone(b)
+	b[0] = 'x'
+
+	if got, err := d.ReadBytes("users", "john"); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("ReadBytes = %q, %v; want %q", got, err, want)
+	}
+}
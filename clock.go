@@ -0,0 +1,15 @@
+package minidb
+
+import "time"
+
+// Clock tells the Driver the time, for everything time-based such as record
+// expiry. Tests can provide one they control to make that deterministic.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
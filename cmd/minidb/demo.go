@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	minidb "github.com/arnabry11/mini-database"
+)
+
+type Address struct {
+	City    string
+	State   string
+	Country string
+	Pincode json.Number
+}
+
+type User struct {
+	Name    string
+	Age     json.Number
+	Contact string
+	Company string
+	Address Address
+}
+
+// demo writes a handful of sample users and prints them back.
+func demo(db *minidb.Driver) error {
+	employees := []User{
+		{"John", "23", "2378367837", "Google", Address{"Dhanbad", "Jharkhand", "India", "828122"}},
+		{"Doe", "25", "2378367837", "Facebook", Address{"Ranchi", "Jharkhand", "India", "828133"}},
+		{"Jane", "27", "2378367837", "Amazon", Address{"Jamshedpur", "Jharkhand", "India", "821645"}},
+		{"Dane", "29", "2378367837", "Microsoft", Address{"Jamtara", "Jharkhand", "India", "287334"}},
+		{"Pete", "31", "2378367837", "Apple", Address{"Bokaro", "Jharkhand", "India", "179232"}},
+		{"Steve", "33", "2378367837", "Tesla", Address{"Bhuli", "Jharkhand", "India", "987632"}},
+	}
+
+	for _, employee := range employees {
+		if err := db.Write("users", employee.Name, employee); err != nil {
+			return err
+		}
+	}
+
+	allUsers := []User{}
+
+	if err := db.ReadAllInto("users", &allUsers); err != nil {
+		return err
+	}
+
+	fmt.Println(allUsers)
+
+	return nil
+}
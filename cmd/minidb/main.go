@@ -0,0 +1,153 @@
+// Command minidb inspects and edits a mini-database directory from the shell.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	minidb "github.com/arnabry11/mini-database"
+)
+
+const usage = `Usage: minidb [--dir DIR] <command> [arguments]
+
+Commands:
+  write <collection> <resource> [file.json]  save a record, read from stdin without a file
+  read <collection> <resource>               print a record
+  list <collection>                          print the names of a collection's records
+  delete <collection> <resource>             delete a record
+  demo                                       write and print some sample users
+
+Flags:
+`
+
+func main() {
+	flags := flag.NewFlagSet("minidb", flag.ExitOnError)
+	dir := flags.String("dir", ".", "database directory")
+
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	db, err := minidb.New(*dir, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if err := run(db, flags.Arg(0), flags.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+
+		if _, ok := err.(usageError); ok {
+			flags.Usage()
+			os.Exit(2)
+		}
+
+		os.Exit(1)
+	}
+}
+
+// usageError is returned for a command called with the wrong arguments.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+func run(db *minidb.Driver, command string, args []string) error {
+	switch command {
+	case "write":
+		if len(args) != 2 && len(args) != 3 {
+			return usageError("write takes a collection, a resource and an optional file")
+		}
+
+		return write(db, args[0], args[1], args[2:])
+	case "read":
+		if len(args) != 2 {
+			return usageError("read takes a collection and a resource")
+		}
+
+		return read(db, args[0], args[1])
+	case "list":
+		if len(args) != 1 {
+			return usageError("list takes a collection")
+		}
+
+		return db.Each(args[0], func(resource string, _ []byte) error {
+			_, err := fmt.Println(resource)
+			return err
+		})
+	case "delete":
+		if len(args) != 2 {
+			return usageError("delete takes a collection and a resource")
+		}
+
+		// Delete removes the whole collection when given no resource.
+		if args[1] == "" {
+			return usageError("delete needs a resource name")
+		}
+
+		return db.Delete(args[0], args[1])
+	case "demo":
+		return demo(db)
+	}
+
+	return usageError(fmt.Sprintf("unknown command %q", command))
+}
+
+func write(db *minidb.Driver, collection, resource string, file []string) error {
+	in := io.Reader(os.Stdin)
+
+	if len(file) > 0 {
+		f, err := os.Open(file[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		in = f
+	}
+
+	b, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	if !json.Valid(b) {
+		return fmt.Errorf("the record is not valid JSON")
+	}
+
+	return db.Write(collection, resource, json.RawMessage(b))
+}
+
+func read(db *minidb.Driver, collection, resource string) error {
+	var record json.RawMessage
+
+	if err := db.Read(collection, resource, &record); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+
+	if err := json.Indent(&out, record, "", "  "); err != nil {
+		return err
+	}
+
+	out.WriteByte('\n')
+
+	_, err := out.WriteTo(os.Stdout)
+
+	return err
+}
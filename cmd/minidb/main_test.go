@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jcelliott/lumber"
+
+	minidb "github.com/arnabry11/mini-database"
+)
+
+// newTestDB opens a database on a fresh temporary directory that only logs
+// fatal errors, keeping the test output clean.
+func newTestDB(t *testing.T) *minidb.Driver {
+	t.Helper()
+
+	db, err := minidb.New(t.TempDir(), &minidb.Options{Logger: lumber.NewConsoleLogger(lumber.FATAL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestRun(t *testing.T) {
+	db := newTestDB(t)
+
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "john.json")
+	if err := os.WriteFile(valid, []byte(`{"name": "john"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(invalid, []byte(`{`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		command string
+		args    []string
+		usage   bool
+		fails   bool
+	}{
+		{"write", []string{"users", "john", valid}, false, false},
+		{"write", []string{"users", "jane", invalid}, false, true},
+		{"write", []string{"users", "jane", filepath.Join(dir, "missing.json")}, false, true},
+		{"write", []string{"users"}, true, true},
+		{"read", []string{"users", "john"}, false, false},
+		{"read", []string{"users", "jane"}, false, true},
+		{"read", []string{"users"}, true, true},
+		{"list", []string{"users"}, false, false},
+		{"list", nil, true, true},
+		{"delete", []string{"users", ""}, true, true},
+		{"delete", []string{"users", "john"}, false, false},
+		{"delete", []string{"users", "john"}, false, true},
+		{"frobnicate", nil, true, true},
+	}
+
+	for _, tt := range tests {
+		err := run(db, tt.command, tt.args)
+
+		var usage usageError
+		if (err != nil) != tt.fails || errors.As(err, &usage) != tt.usage {
+			t.Errorf("run(%s, %q) = %v, want failure %v, usage error %v", tt.command, tt.args, err, tt.fails, tt.usage)
+		}
+	}
+
+	if exists, _ := db.Exists("users", "jane"); exists {
+		t.Error("an invalid record was written")
+	}
+}
@@ -0,0 +1,101 @@
+package minidb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Codec converts records to and from the bytes stored on disk. Extension is
+// the file suffix, including the leading dot, that records are saved under.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(b []byte, v interface{}) error
+	Extension() string
+}
+
+// JSONCodec stores records as tab-indented JSON, or as compact single-line
+// JSON when Compact is set. Canonical sorts the keys of every object, struct
+// fields included, so equal records always marshal to the same bytes.
+type JSONCodec struct {
+	Compact   bool
+	Canonical bool
+}
+
+func (c JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	if c.Canonical {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		// Decoded into maps, objects marshal with sorted keys; numbers are
+		// kept as they were written.
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+
+		v = doc
+	}
+
+	if c.Compact {
+		return json.Marshal(v)
+	}
+
+	return json.MarshalIndent(v, "", "\t")
+}
+
+func (JSONCodec) Unmarshal(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
+
+func (JSONCodec) Extension() string {
+	return ".json"
+}
+
+type YAMLCodec struct{}
+
+func (YAMLCodec) Marshal(v interface{}) ([]byte, error) {
+	return yaml.Marshal(v)
+}
+
+func (YAMLCodec) Unmarshal(b []byte, v interface{}) error {
+	return yaml.Unmarshal(b, v)
+}
+
+func (YAMLCodec) Extension() string {
+	return ".yaml"
+}
+
+// GobCodec stores records with encoding/gob, which is smaller and faster than
+// JSON but not human-readable. Gob needs concrete types to decode into, so
+// records must be read back into the type they were written from, or a
+// compatible one: decoding into an interface{}, as ReadMulti does for
+// records it has no destination for, fails. So do the features that inspect
+// records as generic maps, such as Upsert, schemas, indexes, ReadAllSorted
+// and FindByPath.
+type GobCodec struct{}
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(b []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+func (GobCodec) Extension() string {
+	return ".gob"
+}
@@ -0,0 +1,103 @@
+package minidb
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type order struct {
+	ID    int
+	Items []string
+	Total float64
+	Notes map[string]string
+	Owner *user
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	in := order{
+		ID:    7,
+		Items: []string{"a", "b"},
+		Total: 12.5,
+		Notes: map[string]string{"gift": "yes"},
+		Owner: &user{Name: "john", Age: 30},
+	}
+
+	tests := []struct {
+		codec Codec
+		ext   string
+	}{
+		{JSONCodec{}, ".json"},
+		{JSONCodec{Compact: true}, ".json"},
+		{JSONCodec{Canonical: true}, ".json"},
+		{YAMLCodec{}, ".yaml"},
+		{GobCodec{}, ".gob"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.codec.Extension(); got != tt.ext {
+			t.Errorf("%T.Extension() = %s, want %s", tt.codec, got, tt.ext)
+		}
+
+		b, err := tt.codec.Marshal(in)
+		if err != nil {
+			t.Fatalf("%#v.Marshal: %v", tt.codec, err)
+		}
+
+		var out order
+		if err := tt.codec.Unmarshal(b, &out); err != nil {
+			t.Fatalf("%#v.Unmarshal: %v", tt.codec, err)
+		}
+
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("%#v round trip = %+v, want %+v", tt.codec, out, in)
+		}
+
+		// Through a Driver too, which ends text records with a newline.
+		d := newTestDriver(t, &Options{Codec: tt.codec})
+
+		if err := d.Write("orders", "7", in); err != nil {
+			t.Fatal(err)
+		}
+
+		out = order{}
+		if err := d.Read("orders", "7", &out); err != nil || !reflect.DeepEqual(in, out) {
+			t.Errorf("%#v Driver round trip = %+v, %v", tt.codec, out, err)
+		}
+
+		want := b
+		if _, binary := tt.codec.(GobCodec); !binary && !bytes.HasSuffix(b, []byte("\n")) {
+			want = append(b, '\n')
+		}
+
+		if stored, err := d.ReadBytes("orders", "7"); err != nil || !bytes.Equal(stored, want) {
+			t.Errorf("%#v stored %q, %v; want %q", tt.codec, stored, err, want)
+		}
+
+		if err := tt.codec.Unmarshal([]byte("{not valid"), &out); err == nil {
+			t.Errorf("%#v.Unmarshal accepted garbage", tt.codec)
+		}
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	codec := JSONCodec{Compact: true, Canonical: true}
+
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{map[string]interface{}{"b": 1, "a": 2}, `{"a":2,"b":1}`},
+		{struct{ Z, A int }{1, 2}, `{"A":2,"Z":1}`},
+		{json.RawMessage(`{"n": 12345678901234567890, "f": 1.50}`), `{"f":1.50,"n":12345678901234567890}`},
+		{[]interface{}{map[string]int{"y": 1, "x": 2}}, `[{"x":2,"y":1}]`},
+	}
+
+	for _, tt := range tests {
+		b, err := codec.Marshal(tt.v)
+		if err != nil || string(b) != tt.want {
+			t.Errorf("Marshal(%v) = %s, %v; want %s", tt.v, b, err, tt.want)
+		}
+	}
+}
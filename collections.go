@@ -0,0 +1,274 @@
+package minidb
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CopyCollection duplicates every record of src, byte for byte, into a new
+// collection dst. The copy is assembled in a hidden directory and renamed into
+// place, so dst appears complete or not at all.
+func (d *Driver) CopyCollection(src, dst string) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if src == "" || dst == "" {
+		return missingName("Missing collection - unable to copy collection (no name)!")
+	}
+
+	if err := d.validateName(src, dst); err != nil {
+		return err
+	}
+
+	if src == dst {
+		return fmt.Errorf("unable to copy collection %s onto itself", src)
+	}
+
+	unlock := d.lockCollections(src, dst)
+	defer unlock()
+
+	srcDir := filepath.Join(d.dir, src)
+	dstDir := filepath.Join(d.dir, dst)
+
+	if fi, err := d.fs.Stat(srcDir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("unable to find collection named: %s: %w", src, ErrNotFound)
+	}
+
+	if _, err := d.fs.Stat(dstDir); err == nil {
+		return fmt.Errorf("unable to copy to collection %s: already exists", dst)
+	}
+
+	tmpDir, err := d.mkdirTemp("." + dst + "-")
+	if err != nil {
+		return err
+	}
+	defer d.fs.RemoveAll(tmpDir)
+
+	// Everything is copied, shard directories and indexes included, since the
+	// indexes describe the very same records.
+	if err := d.copyTree(srcDir, tmpDir); err != nil {
+		return err
+	}
+
+	d.schemas.Delete(dst)
+	d.forgetIndexes(dst)
+
+	return d.fs.Rename(tmpDir, dstDir)
+}
+
+// MoveCollection renames collection src to dst, which must not exist yet. The
+// directory is renamed in one step, which is atomic on a single filesystem.
+func (d *Driver) MoveCollection(src, dst string) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if src == "" || dst == "" {
+		return missingName("Missing collection - unable to move collection (no name)!")
+	}
+
+	if err := d.validateName(src, dst); err != nil {
+		return err
+	}
+
+	if src == dst {
+		return nil
+	}
+
+	unlock := d.lockCollections(src, dst)
+	defer unlock()
+
+	srcDir := filepath.Join(d.dir, src)
+	dstDir := filepath.Join(d.dir, dst)
+
+	if fi, err := d.fs.Stat(srcDir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("unable to find collection named: %s: %w", src, ErrNotFound)
+	}
+
+	if _, err := d.fs.Stat(dstDir); err == nil {
+		return fmt.Errorf("unable to move to collection %s: already exists", dst)
+	}
+
+	d.cache.removeCollection(src)
+	d.schemas.Delete(src)
+	d.schemas.Delete(dst)
+	d.forgetIndexes(src)
+	d.forgetIndexes(dst)
+
+	if err := d.fs.Rename(srcDir, dstDir); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	delete(d.mutexes, src)
+	d.mutex.Unlock()
+
+	return nil
+}
+
+// MoveRecord moves a record, with its TTL and version, from collection src to
+// dst, renaming its file in one step like Rename. The record must pass dst's
+// schema and unique indexes. A record already in dst is only replaced with
+// AllowOverwrite; otherwise it fails with ErrExists.
+func (d *Driver) MoveRecord(src, resource, dst string) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if src == "" || dst == "" {
+		return missingName("Missing collection - unable to move record (no name)!")
+	}
+
+	if resource == "" {
+		return missingName("Missing resource - unable to move record (no name)!")
+	}
+
+	if err := d.validateName(src, resource, dst); err != nil {
+		return err
+	}
+
+	resource = d.canonical(resource)
+
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	unlock := d.lockCollections(src, dst)
+	defer unlock()
+
+	path, fi, err := d.recordFile(src, resource)
+	if err != nil {
+		return notFound(err)
+	}
+
+	if src == dst {
+		return nil
+	}
+
+	b, err := d.readFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := d.checkWritable(dst, resource, b); err != nil {
+		return err
+	}
+
+	existing, _, err := d.recordFile(dst, resource)
+	switch {
+	case err == nil && !d.allowOverwrite:
+		return fmt.Errorf("unable to move %s to collection %s: %w", resource, dst, ErrExists)
+	case err == nil:
+	case os.IsNotExist(err):
+		existing = ""
+	default:
+		return err
+	}
+
+	d.indexMutex.Lock()
+
+	index, err := d.updateIndexes(dst, map[string][]byte{resource: b})
+	if err == nil {
+		err = d.moveRecordFile(src, dst, resource, path, existing, fi.Name())
+	}
+
+	if err == nil && index != nil {
+		err = index(resource)
+	}
+
+	d.indexMutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	pending.delete(src, resource)
+	pending.write(dst, resource, b)
+
+	return d.unindex(src, resource)
+}
+
+// moveRecordFile renames the file of a record of src, named name, into dst
+// along with its metadata, replacing the existing record if there is one.
+func (d *Driver) moveRecordFile(src, dst, resource, path, existing, name string) error {
+	dir := d.shard(filepath.Join(d.dir, dst), resource)
+
+	if err := d.fs.MkdirAll(dir, d.dirPerm); err != nil {
+		return err
+	}
+
+	if existing != "" {
+		if err := d.fs.Remove(existing); err != nil {
+			return err
+		}
+	}
+
+	d.cache.remove(cacheKey(src, resource))
+	d.cache.remove(cacheKey(dst, resource))
+
+	if err := d.fs.Rename(path, filepath.Join(dir, name)); err != nil {
+		return err
+	}
+
+	err := d.fs.Rename(d.metaPath(src, resource), d.metaPath(dst, resource))
+	if os.IsNotExist(err) {
+		err = d.fs.Remove(d.metaPath(dst, resource))
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// copyTree copies the regular files under src to the existing directory dst,
+// keeping their relative paths and leaving out in-flight ".tmp" files.
+func (d *Driver) copyTree(src, dst string) error {
+	return d.walkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+
+		if err := d.fs.MkdirAll(filepath.Dir(target), d.dirPerm); err != nil {
+			return err
+		}
+
+		return d.copyFile(path, target)
+	})
+}
+
+func (d *Driver) copyFile(src, dst string) error {
+	b, err := d.fs.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	return d.fs.WriteFile(dst, b, d.filePerm)
+}
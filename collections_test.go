@@ -0,0 +1,137 @@
+package minidb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// errAny stands for any error in tables of expected errors.
+var errAny = errors.New("any error")
+
+func TestCopyMoveCollection(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("admins", "root", user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		op   func() error
+		want error // errAny for any error
+	}{
+		{"copy", func() error { return d.CopyCollection("users", "backup") }, nil},
+		{"copy onto existing", func() error { return d.CopyCollection("users", "admins") }, errAny},
+		{"copy missing", func() error { return d.CopyCollection("missing", "other") }, ErrNotFound},
+		{"move", func() error { return d.MoveCollection("backup", "archive") }, nil},
+		{"move onto existing", func() error { return d.MoveCollection("users", "admins") }, errAny},
+		{"move missing", func() error { return d.MoveCollection("backup", "other") }, ErrNotFound},
+		{"invalid name", func() error { return d.MoveCollection("users", "../x") }, ErrInvalidName},
+	}
+
+	for _, tt := range tests {
+		err := tt.op()
+		if tt.want == nil && err != nil || tt.want == errAny && err == nil || tt.want != nil && tt.want != errAny && !errors.Is(err, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	collections, err := d.Collections()
+	if want := []string{"admins", "archive", "users"}; err != nil || !reflect.DeepEqual(collections, want) {
+		t.Errorf("Collections = %v, %v; want %v", collections, err, want)
+	}
+
+	var u user
+	if err := d.Read("archive", "john", &u); err != nil || u.Name != "john" {
+		t.Errorf("archive/john = %+v, %v", u, err)
+	}
+}
+
+func TestMoveRecord(t *testing.T) {
+	clock := newFakeClock()
+
+	tests := []struct {
+		name  string
+		opts  Options
+		setup func(d *Driver) error
+		want  error
+	}{
+		{"move", Options{}, nil, nil},
+		{"existing", Options{}, func(d *Driver) error { return d.Write("admins", "john", user{}) }, ErrExists},
+		{"overwrite", Options{AllowOverwrite: true}, func(d *Driver) error { return d.Write("admins", "john", user{}) }, nil},
+		{"schema", Options{}, func(d *Driver) error { return d.SetSchema("admins", []byte(`{"required": ["Role"]}`)) }, ErrSchemaViolation},
+		{"unique", Options{}, func(d *Driver) error {
+			if err := d.AddUniqueIndex("admins", "Name"); err != nil {
+				return err
+			}
+			return d.Write("admins", "other", user{Name: "john"})
+		}, ErrUniqueViolation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Clock = clock
+			d := newTestDriver(t, &tt.opts)
+
+			if _, err := d.WriteIfVersion("users", "john", user{Name: "john"}, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := d.WriteWithTTL("users", "temp", user{}, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.setup != nil {
+				if err := tt.setup(d); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := d.MoveRecord("users", "john", "admins")
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("MoveRecord = %v, want %v", err, tt.want)
+			}
+
+			if exists, _ := d.Exists("users", "john"); exists != (tt.want != nil) {
+				t.Errorf("users/john exists %v after MoveRecord = %v", exists, err)
+			}
+
+			if tt.want != nil {
+				return
+			}
+
+			// The version comes along.
+			var u user
+			if version, err := d.ReadWithVersion("admins", "john", &u); err != nil || version != 1 || u.Name != "john" {
+				t.Errorf("admins/john = %+v at version %d, %v", u, version, err)
+			}
+		})
+	}
+
+	// So does the TTL.
+	d := newTestDriver(t, &Options{Clock: clock})
+
+	if err := d.WriteWithTTL("users", "temp", user{}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.MoveRecord("users", "temp", "admins"); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Minute)
+
+	if exists, _ := d.Exists("admins", "temp"); exists {
+		t.Error("moved record lost its TTL")
+	}
+
+	if err := d.MoveRecord("users", "nobody", "admins"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("MoveRecord(nobody) = %v, want ErrNotFound", err)
+	}
+}
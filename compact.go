@@ -0,0 +1,272 @@
+package minidb
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// staleTmpAge is how old a ".tmp" file has to be for Compact to consider it
+// abandoned rather than part of a write in progress in another process.
+const staleTmpAge = time.Minute
+
+// Compact removes the ".tmp" files a crashed write left behind in a collection
+// and returns how many it removed. Only files older than a minute are touched,
+// so writes in flight in other processes sharing the directory are safe.
+func (d *Driver) Compact(collection string) (int, error) {
+	if d.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	if collection == "" {
+		return 0, missingName("Missing collection - no place to compact!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return 0, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	if _, err := d.fs.Stat(dir); err != nil {
+		return 0, notFound(err)
+	}
+
+	removed := 0
+
+	err := d.walkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || !strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+
+		fi, err := entry.Info()
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if d.clock.Now().Sub(fi.ModTime()) < staleTmpAge {
+			return nil
+		}
+
+		if err := d.fs.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		removed++
+
+		return nil
+	})
+
+	return removed, err
+}
+
+func (d *Driver) compactAll() error {
+	collections, err := d.Collections()
+	if err != nil {
+		return err
+	}
+
+	for _, collection := range collections {
+		removed, err := d.Compact(collection)
+		if err != nil {
+			return fmt.Errorf("unable to compact collection %s: %w", collection, err)
+		}
+
+		if removed > 0 {
+			d.log.Info("Removed %d abandoned temporary files from '%s' \n", removed, collection)
+		}
+	}
+
+	return nil
+}
+
+// reclaimPrefix and reclaimedPrefix name the hidden directories, at the root
+// of the database, that Reclaim builds a collection's new directory in and
+// moves its old one aside to. validateName keeps collections from starting
+// with a dot, so New can remove whatever it finds under them.
+const (
+	reclaimPrefix   = ".reclaim-"
+	reclaimedPrefix = ".reclaimed-"
+)
+
+// Reclaim rebuilds a collection's directory from scratch, holding only its
+// live records, their metadata, its schema and its indexes, and swaps it in
+// for the old one, so that filesystems that never shrink directories give
+// back what churn took. Expired records and leftover ".tmp" files are
+// dropped. The old directory is moved aside before the new one is moved in,
+// and New puts it back if the swap was interrupted in between.
+func (d *Driver) Reclaim(collection string) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to reclaim!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	dir := filepath.Join(d.dir, collection)
+	fresh := filepath.Join(d.dir, reclaimPrefix+collection)
+	old := filepath.Join(d.dir, reclaimedPrefix+collection)
+
+	if fi, err := d.fs.Stat(dir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("unable to find collection named: %s: %w", collection, ErrNotFound)
+	}
+
+	if err := d.fs.RemoveAll(fresh); err != nil {
+		return err
+	}
+	defer d.fs.RemoveAll(fresh)
+
+	if err := d.fs.MkdirAll(fresh, d.dirPerm); err != nil {
+		return err
+	}
+
+	err := d.walkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() || !d.live(collection, path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(fresh, rel)
+
+		if err := d.fs.MkdirAll(filepath.Dir(target), d.dirPerm); err != nil {
+			return err
+		}
+
+		return d.copyFile(path, target)
+	})
+	if err != nil {
+		return err
+	}
+
+	d.cache.removeCollection(collection)
+	d.forgetIndexes(collection)
+
+	if err := d.fs.Rename(dir, old); err != nil {
+		return err
+	}
+
+	if err := d.fs.Rename(fresh, dir); err != nil {
+		// Put the old directory back rather than leave the collection missing.
+		if rerr := d.fs.Rename(old, dir); rerr != nil {
+			d.log.Error("Unable to restore collection %s from %s: %s\n", collection, old, rerr)
+		}
+
+		return err
+	}
+
+	if err := d.persisted(dir); err != nil {
+		return err
+	}
+
+	if err := d.fs.RemoveAll(old); err != nil {
+		return err
+	}
+
+	// Indexes may still list the expired records that were dropped.
+	return d.rebuildIndexes(collection)
+}
+
+// live reports whether Reclaim keeps the file at path, inside the collection's
+// directory: anything but ".tmp" files, expired records and the metadata of
+// records that are gone.
+func (d *Driver) live(collection, path string) bool {
+	dir := filepath.Join(d.dir, collection)
+	name := filepath.Base(path)
+
+	switch {
+	case strings.HasSuffix(name, ".tmp"):
+		return false
+	case filepath.Dir(path) != dir && strings.HasPrefix(filepath.Base(filepath.Dir(path)), "."):
+		// Hidden directories, such as the one holding indexes, are kept whole.
+		return true
+	case d.isRecordName(collection, name):
+		return !d.expired(dir, d.recordName(collection, name))
+	case strings.HasSuffix(name, metaExt):
+		resource := strings.TrimSuffix(name, metaExt)
+		_, _, err := d.recordFile(collection, resource)
+		return err == nil
+	}
+
+	return true
+}
+
+// recoverReclaims finishes or undoes the Reclaims that were interrupted: a
+// collection whose old directory had been moved aside but whose new one
+// hadn't been moved in yet gets the old one back, and leftovers are removed.
+func (d *Driver) recoverReclaims() error {
+	files, err := d.fs.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+
+		if !file.IsDir() || !strings.HasPrefix(name, reclaimedPrefix) {
+			continue
+		}
+
+		collection := strings.TrimPrefix(name, reclaimedPrefix)
+		dir := filepath.Join(d.dir, collection)
+
+		if _, err := d.fs.Stat(dir); os.IsNotExist(err) {
+			d.log.Info("Restoring collection '%s' after an interrupted reclaim \n", collection)
+
+			if err := d.fs.Rename(filepath.Join(d.dir, name), dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range files {
+		name := file.Name()
+
+		if file.IsDir() && (strings.HasPrefix(name, reclaimPrefix) || strings.HasPrefix(name, reclaimedPrefix)) {
+			if err := d.fs.RemoveAll(filepath.Join(d.dir, name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
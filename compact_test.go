@@ -0,0 +1,198 @@
+package minidb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReclaim(t *testing.T) {
+	clock := newFakeClock()
+	d := newTestDriver(t, &Options{Clock: clock})
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.WriteWithTTL("users", "temp", user{}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(d.dir, "users", "jane.json.tmp"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Hour)
+
+	if err := d.Reclaim("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(d.dir, "users"))
+
+	for _, entry := range entries {
+		if name := entry.Name(); name != "john.json" {
+			t.Errorf("%s left behind by Reclaim", name)
+		}
+	}
+
+	var u user
+	if err := d.Read("users", "john", &u); err != nil || u.Name != "john" {
+		t.Errorf("Read after Reclaim = %+v, %v", u, err)
+	}
+}
+
+func TestRecoverReclaims(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// setup leaves the database as an interrupted Reclaim of "users"
+		// would have.
+		setup func(dir string) error
+	}{
+		{"new directory being built", func(dir string) error {
+			return os.MkdirAll(filepath.Join(dir, reclaimPrefix+"users"), 0755)
+		}},
+		{"old directory moved aside", func(dir string) error {
+			return os.Rename(filepath.Join(dir, "users"), filepath.Join(dir, reclaimedPrefix+"users"))
+		}},
+		{"swap done", func(dir string) error {
+			return os.MkdirAll(filepath.Join(dir, reclaimedPrefix+"users"), 0755)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			d, err := New(dir, &Options{Logger: quietLogger{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, collection := range []string{"users", "orders"} {
+				if err := d.Write(collection, "a", user{Name: collection}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Collections can't take the names Reclaim works under.
+			if err := d.Write(reclaimPrefix+"users", "a", user{}); !errors.Is(err, ErrInvalidName) {
+				t.Errorf("Write(%q) = %v, want ErrInvalidName", reclaimPrefix+"users", err)
+			}
+
+			d.Close()
+
+			if err := tt.setup(dir); err != nil {
+				t.Fatal(err)
+			}
+
+			d, err = New(dir, &Options{Logger: quietLogger{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+
+			for _, collection := range []string{"users", "orders"} {
+				var u user
+				if err := d.Read(collection, "a", &u); err != nil || u.Name != collection {
+					t.Errorf("Read(%s) after reopening = %+v, %v", collection, u, err)
+				}
+			}
+
+			entries, _ := os.ReadDir(dir)
+
+			for _, entry := range entries {
+				if name := entry.Name(); name[0] == '.' && entry.IsDir() && name != trashDir {
+					t.Errorf("%s left behind by New", name)
+				}
+			}
+		})
+	}
+}
+
+func TestCompact(t *testing.T) {
+	d := newTestDriver(t, &Options{ShardDepth: 1})
+
+	if err := d.Write("users", "john", user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-time.Hour)
+
+	files := []struct {
+		name  string
+		stale bool
+	}{
+		{"jane.json.tmp", true},
+		{"bob.json.tmp", false},
+	}
+
+	for _, f := range files {
+		path := filepath.Join(d.shard(filepath.Join(d.dir, "users"), f.name), f.name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if f.stale {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if n, err := d.Compact("users"); err != nil || n != 1 {
+		t.Fatalf("Compact = %d, %v; want 1", n, err)
+	}
+
+	for _, f := range files {
+		path := filepath.Join(d.shard(filepath.Join(d.dir, "users"), f.name), f.name)
+
+		if _, err := os.Stat(path); os.IsNotExist(err) != f.stale {
+			t.Errorf("%s: stale %v, but Stat = %v", f.name, f.stale, err)
+		}
+	}
+
+	if exists, _ := d.Exists("users", "john"); !exists {
+		t.Error("Compact removed a record")
+	}
+
+	if _, err := d.Compact("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Compact(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCompactOnOpen(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, collection := range []string{"users", "orders"} {
+		if err := os.MkdirAll(filepath.Join(dir, collection), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(dir, collection, "x.json.tmp")
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		old := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newTestDriverAt(t, dir, &Options{CompactOnOpen: true})
+
+	for _, collection := range []string{"users", "orders"} {
+		if _, err := os.Stat(filepath.Join(dir, collection, "x.json.tmp")); !os.IsNotExist(err) {
+			t.Errorf("%s: stale .tmp file left by CompactOnOpen: %v", collection, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package minidb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CollectionOptions override Options for a single collection. Fields left nil
+// fall back to the Driver's Options.
+type CollectionOptions struct {
+	// Compress overrides Options.Compress.
+	Compress *bool
+
+	// CompactJSON overrides Options.CompactJSON. It only applies with
+	// JSONCodec.
+	CompactJSON *bool
+
+	// MaxRecordBytes overrides Options.MaxRecordBytes. Zero lifts the limit.
+	MaxRecordBytes *int
+
+	// Extension overrides Options.FileExtension. Records already stored under
+	// another extension aren't seen anymore once it's changed.
+	Extension string
+
+	// Schema, when set, is attached to the collection as with SetSchema.
+	Schema []byte
+}
+
+// ConfigureCollection sets the overrides for a collection, replacing any set
+// before. They apply to records written from then on; existing records are
+// read back either way. Overrides are kept in memory, so they need setting
+// again every time the database is opened, except for the schema, which is
+// saved with the collection.
+func (d *Driver) ConfigureCollection(collection string, opts CollectionOptions) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - unable to configure collection (no name)!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return err
+	}
+
+	if opts.Extension != "" && !strings.HasPrefix(opts.Extension, ".") {
+		opts.Extension = "." + opts.Extension
+	}
+
+	if ext := opts.Extension; ext == "." || ext == metaExt || ext == ".tmp" || strings.ContainsAny(ext, `/\`) {
+		return fmt.Errorf("%w %q - not a record extension", ErrInvalidName, opts.Extension)
+	}
+
+	if opts.Schema != nil {
+		if err := d.SetSchema(collection, opts.Schema); err != nil {
+			return err
+		}
+	}
+
+	d.collectionOpts.Store(collection, opts)
+
+	return nil
+}
+
+func (d *Driver) collectionOptions(collection string) CollectionOptions {
+	opts, _ := d.collectionOpts.Load(collection)
+	o, _ := opts.(CollectionOptions)
+
+	return o
+}
+
+// compressed reports whether records written to the collection are gzipped.
+func (d *Driver) compressed(collection string) bool {
+	if c := d.collectionOptions(collection).Compress; c != nil {
+		return *c
+	}
+
+	return d.compress
+}
+
+// codecFor returns the Codec records of the collection are marshalled with.
+func (d *Driver) codecFor(collection string) Codec {
+	compact := d.collectionOptions(collection).CompactJSON
+	if compact == nil {
+		return d.codec
+	}
+
+	if c, ok := d.codec.(JSONCodec); ok {
+		c.Compact = *compact
+		return c
+	}
+
+	return d.codec
+}
+
+// recordLimit returns the size limit of the collection's records, zero
+// for none.
+func (d *Driver) recordLimit(collection string) int {
+	if n := d.collectionOptions(collection).MaxRecordBytes; n != nil {
+		return *n
+	}
+
+	return d.maxRecordBytes
+}
+
+// extFor returns the extension records of the collection are stored under.
+func (d *Driver) extFor(collection string) string {
+	if ext := d.collectionOptions(collection).Extension; ext != "" {
+		return ext
+	}
+
+	return d.ext
+}
@@ -0,0 +1,94 @@
+package minidb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConfigureCollection(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		collection string
+		opts       CollectionOptions
+		file       string
+	}{
+		{"users", CollectionOptions{Compress: &no}, "john.json"},
+		{"logs", CollectionOptions{Compress: &yes}, "john.json.gz"},
+		{"notes", CollectionOptions{Extension: "txt"}, "john.txt"},
+		{"archive", CollectionOptions{Extension: ".rec", Compress: &yes}, "john.rec.gz"},
+	}
+
+	d := newTestDriver(t, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.collection, func(t *testing.T) {
+			if err := d.ConfigureCollection(tt.collection, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, name := range []string{"john", "jane"} {
+				if err := d.Write(tt.collection, name, user{Name: name}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if _, err := os.Stat(filepath.Join(d.dir, tt.collection, tt.file)); err != nil {
+				t.Errorf("record not stored as %s: %v", tt.file, err)
+			}
+
+			var u user
+			if err := d.Read(tt.collection, "john", &u); err != nil || u.Name != "john" {
+				t.Errorf("Read = %+v, %v", u, err)
+			}
+
+			keys, err := d.Keys(tt.collection)
+			if err != nil || !reflect.DeepEqual(keys, []string{"jane", "john"}) {
+				t.Errorf("Keys = %v, %v", keys, err)
+			}
+
+			records, err := d.ReadAll(tt.collection)
+			if err != nil || len(records) != 2 {
+				t.Errorf("ReadAll = %d records, %v; want 2", len(records), err)
+			}
+
+			if err := d.Delete(tt.collection, "jane"); err != nil {
+				t.Fatal(err)
+			}
+
+			if n, err := d.Count(tt.collection); err != nil || n != 1 {
+				t.Errorf("Count after Delete = %d, %v; want 1", n, err)
+			}
+		})
+	}
+}
+
+func TestConfigureCollectionExtension(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for _, ext := range []string{".", ".meta", ".tmp", "a/b", `.a\b`} {
+		if err := d.ConfigureCollection("notes", CollectionOptions{Extension: ext}); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("ConfigureCollection(Extension: %q) = %v, want ErrInvalidName", ext, err)
+		}
+	}
+
+	if err := d.ConfigureCollection("notes", CollectionOptions{Extension: ".txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A stray file in the global extension isn't a record of the collection.
+	if err := d.Write("notes", "a", user{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(d.dir, "notes", "b.json"), []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys, err := d.Keys("notes"); err != nil || !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Errorf("Keys = %v, %v; want [a]", keys, err)
+	}
+}
@@ -0,0 +1,86 @@
+package minidb
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Cursor steps through the records of a collection one at a time, for paging
+// forward without holding more than one record in memory. It goes by the
+// collection's listing taken when it was created: records created since then
+// aren't included, records deleted since are skipped, and each record is read
+// as it is when Next gets to it. A Cursor is not safe for concurrent use.
+type Cursor struct {
+	d          *Driver
+	collection string
+	dir        string
+	files      []string
+}
+
+// Cursor returns a Cursor over the records of a collection, in name order.
+func (d *Driver) Cursor(collection string) (*Cursor, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	if collection == "" {
+		return nil, missingName("Missing collection - no place to read records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	if _, err := d.stat(collection, dir); err != nil {
+		return nil, notFound(err)
+	}
+
+	files, err := d.listRecords(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cursor{d: d, collection: collection, dir: dir, files: files}, nil
+}
+
+// Next returns the next record along with its name, or false once there are
+// no more.
+func (c *Cursor) Next() (resource string, raw []byte, ok bool, err error) {
+	for len(c.files) > 0 {
+		if c.d.closed.Load() {
+			return "", nil, false, ErrClosed
+		}
+
+		file := c.files[0]
+		c.files = c.files[1:]
+
+		mutex := c.d.getOrCreateMutex(c.collection)
+		mutex.RLock()
+		b, err := c.d.readFile(filepath.Join(c.dir, file))
+		mutex.RUnlock()
+
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return "", nil, false, err
+		}
+
+		return c.d.recordName(c.collection, file), b, true, nil
+	}
+
+	return "", nil, false, nil
+}
+
+// Close releases the listing of the Cursor, after which Next reports no more
+// records.
+func (c *Cursor) Close() {
+	c.files = nil
+}
@@ -0,0 +1,84 @@
+package minidb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	d := newTestDriver(t, &Options{ShardDepth: 1})
+
+	for _, name := range []string{"c", "a", "b", "d"} {
+		if err := d.Write("users", name, user{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := d.Cursor("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes after the cursor was created.
+	if err := d.Delete("users", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "e", user{Name: "e"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "d", user{Name: "d2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+
+	for {
+		resource, raw, ok, err := c.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok {
+			break
+		}
+
+		got = append(got, resource+"="+names(t, []string{string(raw)})[0])
+	}
+
+	if want := []string{"a=a", "c=c", "d=d2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Cursor = %v, want %v", got, want)
+	}
+
+	if _, _, ok, err := c.Next(); ok || err != nil {
+		t.Errorf("Next past the end = %v, %v", ok, err)
+	}
+
+	c, err = d.Cursor("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+
+	if _, _, ok, err := c.Next(); ok || err != nil {
+		t.Errorf("Next after Close = %v, %v", ok, err)
+	}
+
+	if _, err := d.Cursor("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Cursor(missing) = %v, want ErrNotFound", err)
+	}
+
+	c, err = d.Cursor("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Close()
+
+	if _, _, _, err := c.Next(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Next after Close = %v, want ErrClosed", err)
+	}
+}
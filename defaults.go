@@ -0,0 +1,94 @@
+package minidb
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// ReadWithDefaults is Read for a pointer to a struct, which then fills in the
+// fields left at their zero value with the defaults their `default:"..."` tags
+// give, so records written before a field existed read back with a sensible
+// value. Nested structs get theirs too. A field stored with its zero value,
+// such as false or 0, can't be told apart from a missing one and is given its
+// default as well. Defaults can be given for strings, booleans, integers and
+// floats.
+func (d *Driver) ReadWithDefaults(collection, resource string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("unable to apply defaults: need a pointer to a struct, got %T", v)
+	}
+
+	if err := d.Read(collection, resource, v); err != nil {
+		return err
+	}
+
+	return applyDefaults(rv.Elem())
+}
+
+// applyDefaults sets the zero fields of the struct v to their tagged defaults.
+func applyDefaults(v reflect.Value) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if fv.Kind() == reflect.Struct {
+			if err := applyDefaults(fv); err != nil {
+				return err
+			}
+			continue
+		}
+
+		def, ok := field.Tag.Lookup("default")
+		if !ok || !fv.IsZero() {
+			continue
+		}
+
+		if err := setDefault(fv, def); err != nil {
+			return fmt.Errorf("invalid default %q for field %s: %w", def, field.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func setDefault(v reflect.Value, def string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(def)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(def)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(def, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(def, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(def, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("defaults aren't supported for %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package minidb
+
+import (
+	"testing"
+)
+
+type settings struct {
+	Theme   string  `default:"dark"`
+	Size    int     `default:"12"`
+	Scale   float64 `default:"1.5"`
+	Beta    bool    `default:"true"`
+	Plain   string
+	Display struct {
+		Width uint `default:"80"`
+	}
+}
+
+func TestReadWithDefaults(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("settings", "old", map[string]interface{}{"Theme": "light"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var s settings
+	if err := d.ReadWithDefaults("settings", "old", &s); err != nil {
+		t.Fatal(err)
+	}
+
+	want := settings{Theme: "light", Size: 12, Scale: 1.5, Beta: true}
+	want.Display.Width = 80
+
+	if s != want {
+		t.Errorf("ReadWithDefaults = %+v, want %+v", s, want)
+	}
+
+	var bad struct {
+		Size int `default:"big"`
+	}
+
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"not a pointer", settings{}},
+		{"not a struct", new(string)},
+		{"nil", (*settings)(nil)},
+		{"bad default", &bad},
+		{"missing", nil},
+	}
+
+	for _, tt := range tests {
+		resource := "old"
+		if tt.v == nil {
+			resource, tt.v = "missing", &settings{}
+		}
+
+		if err := d.ReadWithDefaults("settings", resource, tt.v); err == nil {
+			t.Errorf("%s: ReadWithDefaults succeeded", tt.name)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package minidb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Durability controls how hard the Driver works to get writes onto the disk
+// before a crash or power loss can take them.
+type Durability int
+
+const (
+	// DurabilityNone leaves flushing writes to the operating system. A
+	// record's rename into place is atomic, but may be lost on power loss.
+	DurabilityNone Durability = iota
+
+	// DurabilitySync flushes every file before it's renamed into place, and
+	// its directory after, so the write is on disk once it returns.
+	DurabilitySync
+
+	// DurabilityBatched flushes written files and their directories in the
+	// background, every SyncInterval, and on Close.
+	DurabilityBatched
+)
+
+// defaultSyncInterval is how often DurabilityBatched flushes by default.
+const defaultSyncInterval = time.Second
+
+// persisted makes the file just renamed into place at path as durable as the
+// Durability option asks.
+func (d *Driver) persisted(path string) error {
+	switch d.durability {
+	case DurabilitySync:
+		return d.sync(filepath.Dir(path))
+	case DurabilityBatched:
+		d.syncer.add(path)
+	}
+
+	return nil
+}
+
+// syncer flushes the files written under DurabilityBatched, along with their
+// directories, from a goroutine of its own.
+type syncer struct {
+	mutex sync.Mutex
+	files map[string]bool
+	sync  func(path string) error
+	log   Logger
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newSyncer(interval time.Duration, sync func(path string) error, log Logger) *syncer {
+	s := &syncer{files: map[string]bool{}, sync: sync, log: log, done: make(chan struct{})}
+
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				if err := s.flush(); err != nil {
+					s.log.Error("Unable to flush writes: %s\n", err)
+				}
+			}
+		}
+	}()
+
+	return s
+}
+
+func (s *syncer) add(path string) {
+	s.mutex.Lock()
+	s.files[path] = true
+	s.mutex.Unlock()
+}
+
+// flush syncs every file added since the last flush, then their directories.
+// Files removed in the meantime are skipped.
+func (s *syncer) flush() error {
+	s.mutex.Lock()
+	files := s.files
+	s.files = map[string]bool{}
+	s.mutex.Unlock()
+
+	var errs []error
+
+	dirs := map[string]bool{}
+
+	for file := range files {
+		if err := s.sync(file); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+
+		dirs[filepath.Dir(file)] = true
+	}
+
+	for dir := range dirs {
+		if err := s.sync(dir); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// stop ends the background flushing, with a last flush.
+func (s *syncer) stop() error {
+	close(s.done)
+	s.wg.Wait()
+
+	return s.flush()
+}
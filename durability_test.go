@@ -0,0 +1,71 @@
+package minidb
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDurability(t *testing.T) {
+	for _, durability := range []Durability{DurabilityNone, DurabilitySync, DurabilityBatched} {
+		dir := t.TempDir()
+		d := newTestDriverAt(t, dir, &Options{Durability: durability, SyncInterval: time.Millisecond})
+
+		if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := d.WriteBatch("users", map[string]interface{}{"jane": user{Name: "jane"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := d.Close(); err != nil {
+			t.Fatalf("Durability %d: Close = %v", durability, err)
+		}
+
+		d = newTestDriverAt(t, dir, nil)
+
+		if n, err := d.Count("users"); err != nil || n != 2 {
+			t.Errorf("Durability %d: Count = %d, %v; want 2", durability, n, err)
+		}
+	}
+}
+
+func TestSyncer(t *testing.T) {
+	var mutex sync.Mutex
+	var synced []string
+
+	s := newSyncer(time.Hour, func(path string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		synced = append(synced, path)
+
+		return nil
+	}, quietLogger{})
+
+	a := filepath.Join("db", "users", "a.json")
+	b := filepath.Join("db", "users", "b.json")
+
+	s.add(a)
+	s.add(b)
+	s.add(a)
+
+	if err := s.stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files come before their directory, which is synced once.
+	if len(synced) != 3 || synced[2] != filepath.Join("db", "users") {
+		t.Fatalf("synced %v", synced)
+	}
+
+	files := synced[:2]
+	sort.Strings(files)
+
+	if files[0] != a || files[1] != b {
+		t.Errorf("synced files %v, want %s and %s", files, a, b)
+	}
+}
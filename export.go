@@ -0,0 +1,172 @@
+package minidb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ExportCollection writes a collection to w as a single JSON object mapping
+// each record's name to the record itself.
+func (d *Driver) ExportCollection(collection string, w io.Writer) error {
+	records := map[string]interface{}{}
+
+	err := d.Each(collection, func(resource string, raw []byte) error {
+		record, err := d.toJSON(raw)
+		if err != nil {
+			return fmt.Errorf("unable to export record %s: %w", resource, err)
+		}
+
+		records[resource] = record
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(records, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(b, '\n'))
+
+	return err
+}
+
+// ImportCollection reads a JSON object like the ones ExportCollection writes
+// and saves each of its entries as a record of collection, with WriteBatch,
+// so an import that fails before its records are renamed into place leaves
+// the collection untouched.
+func (d *Driver) ImportCollection(collection string, r io.Reader) error {
+	var entries map[string]json.RawMessage
+
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field == "" {
+			return fmt.Errorf("unable to import collection %s: expected a JSON object, got %s", collection, typeErr.Value)
+		}
+
+		return fmt.Errorf("unable to import collection %s: %w", collection, err)
+	}
+
+	if entries == nil {
+		return fmt.Errorf("unable to import collection %s: expected a JSON object, got null", collection)
+	}
+
+	records := make(map[string]interface{}, len(entries))
+
+	for resource, raw := range entries {
+		record, err := d.fromJSON(raw)
+		if err != nil {
+			return fmt.Errorf("unable to import record %s: %w", resource, err)
+		}
+
+		records[resource] = record
+	}
+
+	return d.WriteBatch(collection, records)
+}
+
+// toJSON turns a marshalled record into something that encodes as JSON. JSON
+// records are passed through untouched, keeping their numbers exact.
+func (d *Driver) toJSON(raw []byte) (interface{}, error) {
+	if _, ok := d.codec.(JSONCodec); ok {
+		return json.RawMessage(raw), nil
+	}
+
+	var record interface{}
+
+	if err := d.codec.Unmarshal(raw, &record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// fromJSON is the reverse of toJSON, returning a value the codec can marshal.
+func (d *Driver) fromJSON(raw json.RawMessage) (interface{}, error) {
+	if _, ok := d.codec.(JSONCodec); ok {
+		return raw, nil
+	}
+
+	var record interface{}
+
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// dumpEntry is a line of DumpNDJSON's output.
+type dumpEntry struct {
+	Collection string          `json:"collection"`
+	Resource   string          `json:"resource"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// DumpNDJSON writes every record of every collection to w, one JSON object
+// per line holding its collection, its name and the record as data.
+// Collections come in name order, as do their records. JSON records are
+// written as stored, only compacted onto their line.
+func (d *Driver) DumpNDJSON(w io.Writer) error {
+	collections, err := d.Collections()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+
+	for _, collection := range collections {
+		err := d.Each(collection, func(resource string, raw []byte) error {
+			record, err := d.toJSON(raw)
+			if err != nil {
+				return fmt.Errorf("unable to dump record %s: %w", resource, err)
+			}
+
+			data, err := json.Marshal(record)
+			if err != nil {
+				return fmt.Errorf("unable to dump record %s: %w", resource, err)
+			}
+
+			return enc.Encode(dumpEntry{collection, resource, data})
+		})
+		if err != nil {
+			return fmt.Errorf("unable to dump collection %s: %w", collection, err)
+		}
+	}
+
+	return nil
+}
+
+// LoadNDJSON writes every record of a dump made by DumpNDJSON, one at a time,
+// replacing records of the same name. A line that can't be loaded stops it,
+// leaving the records of the lines before it written.
+func (d *Driver) LoadNDJSON(r io.Reader) error {
+	dec := json.NewDecoder(r)
+
+	for line := 1; ; line++ {
+		var entry dumpEntry
+
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to load line %d: %w", line, err)
+		}
+
+		record, err := d.fromJSON(entry.Data)
+		if err != nil {
+			return fmt.Errorf("unable to load line %d: %w", line, err)
+		}
+
+		if err := d.Write(entry.Collection, entry.Resource, record); err != nil {
+			return fmt.Errorf("unable to load line %d: %w", line, err)
+		}
+	}
+}
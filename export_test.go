@@ -0,0 +1,119 @@
+package minidb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	for _, codec := range []Codec{JSONCodec{}, YAMLCodec{}} {
+		src := newTestDriver(t, &Options{Codec: codec})
+
+		for name, age := range map[string]int{"john": 30, "jane": 25} {
+			if err := src.Write("users", name, user{Name: name, Age: age}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := src.ExportCollection("users", &buf); err != nil {
+			t.Fatal(err)
+		}
+
+		dst := newTestDriver(t, &Options{Codec: codec})
+
+		if err := dst.ImportCollection("people", &buf); err != nil {
+			t.Fatal(err)
+		}
+
+		var u user
+		if err := dst.Read("people", "jane", &u); err != nil || u.Age != 25 {
+			t.Errorf("%T: imported jane = %+v, %v", codec, u, err)
+		}
+	}
+
+	if err := newTestDriver(t, nil).ExportCollection("missing", &bytes.Buffer{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ExportCollection(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestImportCollectionErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"array", `[1, 2]`},
+		{"null", `null`},
+		{"truncated", `{"a": {`},
+		{"invalid name", `{"../a": {}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDriver(t, nil)
+
+			if err := d.ImportCollection("users", strings.NewReader(tt.input)); err == nil {
+				t.Error("ImportCollection succeeded")
+			}
+
+			if n, _ := d.Count("users"); n != 0 {
+				t.Errorf("a failed import wrote %d records", n)
+			}
+		})
+	}
+}
+
+func TestDumpLoadNDJSON(t *testing.T) {
+	src := newTestDriver(t, nil)
+
+	if err := src.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := src.Write("orders", "1", json.RawMessage(`{"total": 12345678901234567890}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := src.DumpNDJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"collection":"orders","resource":"1","data":{"total":12345678901234567890}}
+{"collection":"users","resource":"john","data":{"Name":"john","Age":0,"Company":"","State":""}}
+`
+	if buf.String() != want {
+		t.Errorf("DumpNDJSON =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	dst := newTestDriver(t, nil)
+
+	if err := dst.LoadNDJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var u user
+	if err := dst.Read("users", "john", &u); err != nil || u.Name != "john" {
+		t.Errorf("loaded john = %+v, %v", u, err)
+	}
+
+	input := `{"collection":"users","resource":"a","data":{}}
+not json
+{"collection":"users","resource":"b","data":{}}
+`
+	err := dst.LoadNDJSON(strings.NewReader(input))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("LoadNDJSON = %v, want an error on line 2", err)
+	}
+
+	if a, _ := dst.Exists("users", "a"); !a {
+		t.Error("lines before the bad one must be loaded")
+	}
+
+	if b, _ := dst.Exists("users", "b"); b {
+		t.Error("lines after the bad one must not be loaded")
+	}
+}
@@ -0,0 +1,200 @@
+package minidb
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileSystem is what the Driver stores its files in. Errors must be reported
+// the way the os package does, with a missing file reported as an
+// *fs.PathError wrapping fs.ErrNotExist, and ReadDir must sort the entries
+// by name.
+//
+// A FileSystem can also have a method Sync(name string) error that flushes a
+// file or directory to stable storage, which the Durability and WAL options
+// rely on. Without it, they don't flush anything. Likewise, methods
+// Create(name string, perm fs.FileMode) (io.WriteCloser, error) and
+// Open(name string) (io.ReadCloser, error) let WriteStream and ReadStream
+// stream files rather than hold them in memory.
+type FileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	MkdirAll(path string, perm fs.FileMode) error
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// osFS is the FileSystem of the operating system, the default.
+type osFS struct{}
+
+func (osFS) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (osFS) ReadFile(name string) ([]byte, error)         { return os.ReadFile(name) }
+func (osFS) Rename(oldpath, newpath string) error         { return os.Rename(oldpath, newpath) }
+func (osFS) Remove(name string) error                     { return os.Remove(name) }
+func (osFS) RemoveAll(path string) error                  { return os.RemoveAll(path) }
+func (osFS) MkdirAll(path string, perm fs.FileMode) error { return os.MkdirAll(path, perm) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error)   { return os.ReadDir(name) }
+
+func (osFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (osFS) Create(name string, perm fs.FileMode) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+}
+
+func (osFS) Open(name string) (io.ReadCloser, error) { return os.Open(name) }
+
+func (osFS) Sync(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// sync flushes the file or directory at path to disk, if the FileSystem can.
+// A directory must be flushed for the renames and removals in it to be.
+func (d *Driver) sync(path string) error {
+	if s, ok := d.fs.(interface{ Sync(name string) error }); ok {
+		return s.Sync(path)
+	}
+
+	return nil
+}
+
+// writeSynced writes b to path and flushes it to disk before returning.
+func (d *Driver) writeSynced(path string, b []byte, perm fs.FileMode) error {
+	if err := d.fs.WriteFile(path, b, perm); err != nil {
+		return err
+	}
+
+	return d.sync(path)
+}
+
+// mkdirTemp creates a new directory in the database directory, with a name
+// starting with prefix, like os.MkdirTemp.
+func (d *Driver) mkdirTemp(prefix string) (string, error) {
+	dir := filepath.Join(d.dir, prefix+newUUID())
+
+	return dir, d.fs.MkdirAll(dir, d.dirPerm)
+}
+
+// walkDir is filepath.WalkDir over the Driver's FileSystem.
+func (d *Driver) walkDir(root string, fn fs.WalkDirFunc) error {
+	fi, err := d.fs.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = d.walk(root, fs.FileInfoToDirEntry(fi), fn)
+	}
+
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+
+	return err
+}
+
+func (d *Driver) walk(path string, entry fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, entry, nil); err != nil || !entry.IsDir() {
+		if err == filepath.SkipDir && entry.IsDir() {
+			err = nil
+		}
+
+		return err
+	}
+
+	entries, err := d.fs.ReadDir(path)
+	if err != nil {
+		if err = fn(path, entry, err); err != nil {
+			if err == filepath.SkipDir {
+				err = nil
+			}
+
+			return err
+		}
+	}
+
+	for _, e := range entries {
+		if err := d.walk(filepath.Join(path, e.Name()), e, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewFromFS opens a read-only database served from fsys, such as an embed.FS
+// bundling seed data, with the database at its root. Everything that would
+// write fails with ErrReadOnly, whatever options.ReadOnly is, and
+// options.FileSystem is ignored.
+func NewFromFS(fsys fs.FS, options *Options) (*Driver, error) {
+	opts := Options{}
+
+	if options != nil {
+		opts = *options
+	}
+
+	opts.ReadOnly = true
+	opts.FileSystem = ioFS{fsys}
+
+	return New(".", &opts)
+}
+
+// ioFS is the FileSystem of a read-only fs.FS. Paths are relative to its
+// root.
+type ioFS struct {
+	fsys fs.FS
+}
+
+func (f ioFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(f.fsys, filepath.ToSlash(name))
+}
+
+func (f ioFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(f.fsys, filepath.ToSlash(name))
+}
+
+func (f ioFS) Open(name string) (io.ReadCloser, error) {
+	return f.fsys.Open(filepath.ToSlash(name))
+}
+
+func (f ioFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.fsys, filepath.ToSlash(name))
+}
+
+func (ioFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return &fs.PathError{Op: "write", Path: name, Err: ErrReadOnly}
+}
+
+func (ioFS) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: ErrReadOnly}
+}
+
+func (ioFS) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+}
+
+func (ioFS) RemoveAll(path string) error {
+	return &fs.PathError{Op: "removeall", Path: path, Err: ErrReadOnly}
+}
+
+func (ioFS) MkdirAll(path string, perm fs.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: path, Err: ErrReadOnly}
+}
@@ -0,0 +1,172 @@
+package minidb
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// flakyFS is the os FileSystem failing the first calls of ReadFile, WriteFile
+// and Rename on record files with err.
+type flakyFS struct {
+	osFS
+
+	mutex sync.Mutex
+	err   error
+	fails int
+	calls int
+}
+
+func (f *flakyFS) fail(name string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.calls++
+
+	if f.fails > 0 && strings.Contains(name, ".json") {
+		f.fails--
+		return f.err
+	}
+
+	return nil
+}
+
+func (f *flakyFS) ReadFile(name string) ([]byte, error) {
+	if err := f.fail(name); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+
+	return f.osFS.ReadFile(name)
+}
+
+func (f *flakyFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if err := f.fail(name); err != nil {
+		return &fs.PathError{Op: "write", Path: name, Err: err}
+	}
+
+	return f.osFS.WriteFile(name, data, perm)
+}
+
+func (f *flakyFS) Rename(oldpath, newpath string) error {
+	if err := f.fail(oldpath); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+
+	return f.osFS.Rename(oldpath, newpath)
+}
+
+func TestFileSystem(t *testing.T) {
+	fsys := &flakyFS{}
+	d := newTestDriver(t, &Options{FileSystem: fsys})
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var u user
+	if err := d.Read("users", "john", &u); err != nil || u.Name != "john" {
+		t.Errorf("Read = %+v, %v", u, err)
+	}
+
+	if fsys.calls == 0 {
+		t.Error("the FileSystem option wasn't used")
+	}
+
+	if d.Local() {
+		t.Error("Local = true with a FileSystem set")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		err    error
+		fails  int
+		ok     bool
+	}{
+		{"no policy", RetryPolicy{}, syscall.EAGAIN, 1, false},
+		{"recovers", RetryPolicy{Attempts: 3, Backoff: time.Microsecond}, syscall.EAGAIN, 2, true},
+		{"gives up", RetryPolicy{Attempts: 3, Backoff: time.Microsecond}, syscall.EBUSY, 3, false},
+		{"not retryable", RetryPolicy{Attempts: 3, Backoff: time.Microsecond}, syscall.EACCES, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := &flakyFS{}
+			d := newTestDriver(t, &Options{FileSystem: fsys, Retry: tt.policy})
+
+			if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+				t.Fatal(err)
+			}
+
+			fsys.err, fsys.fails = tt.err, tt.fails
+
+			var u user
+
+			err := d.Read("users", "john", &u)
+			if tt.ok != (err == nil) || err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Read = %v, want success %v", err, tt.ok)
+			}
+
+			fsys.err, fsys.fails = tt.err, tt.fails
+
+			err = d.Write("users", "john", user{Name: "jane"})
+			if tt.ok != (err == nil) || err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Write = %v, want success %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNewFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"users/john.json":     {Data: []byte(`{"Name": "john"}`)},
+		"users/jane.json":     {Data: []byte(`{"Name": "jane"}`)},
+		"users/_schema.json":  {Data: []byte(`{}`)},
+		"orders/1/2/3.json":   {Data: []byte(`{}`)},
+		"users/notes.txt":     {Data: []byte(`ignored`)},
+		"users/.indexes/x.ix": {Data: []byte(`ignored`)},
+	}
+
+	d, err := NewFromFS(fsys, &Options{Logger: quietLogger{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	var u user
+	if err := d.Read("users", "john", &u); err != nil || u.Name != "john" {
+		t.Errorf("Read = %+v, %v", u, err)
+	}
+
+	if keys, err := d.Keys("users"); err != nil || len(keys) != 2 {
+		t.Errorf("Keys = %v, %v; want jane and john", keys, err)
+	}
+
+	if collections, err := d.Collections(); err != nil || len(collections) != 2 {
+		t.Errorf("Collections = %v, %v", collections, err)
+	}
+
+	if err := d.Read("users", "bob", &u); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read(bob) = %v, want ErrNotFound", err)
+	}
+
+	if err := d.Write("users", "bob", user{}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Write = %v, want ErrReadOnly", err)
+	}
+
+	if _, err := d.Increment("users", "john", "Age", 1); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Increment = %v, want ErrReadOnly", err)
+	}
+
+	if d.Local() {
+		t.Error("Local = true for an fs.FS")
+	}
+}
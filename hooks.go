@@ -0,0 +1,106 @@
+package minidb
+
+// Hooks are notified of changes made through a Driver. OnWrite receives the
+// record as marshalled, before compression or encryption. Hooks run after the
+// change is on disk and the collection lock is released, on the goroutine that
+// made the change; they must not call back into the Driver for the same
+// collection while that goroutine holds a lock of its own, e.g. from within
+// Each, or they will deadlock.
+type Hooks struct {
+	OnWrite  func(collection, resource string, raw []byte)
+	OnDelete func(collection, resource string)
+}
+
+// Subscribe registers hooks to be called on every write and delete and returns
+// a func that unregisters them again.
+func (d *Driver) Subscribe(h Hooks) (unsubscribe func()) {
+	d.hooksMutex.Lock()
+	defer d.hooksMutex.Unlock()
+
+	id := d.nextHook
+	d.nextHook++
+	d.hooks[id] = h
+
+	return func() {
+		d.hooksMutex.Lock()
+		delete(d.hooks, id)
+		d.hooksMutex.Unlock()
+	}
+}
+
+func (d *Driver) notifyWrite(collection, resource string, raw []byte) {
+	if raw == nil {
+		return
+	}
+
+	for _, h := range d.subscribers() {
+		if h.OnWrite != nil {
+			h.OnWrite(collection, resource, raw)
+		}
+	}
+}
+
+func (d *Driver) notifyDelete(collection, resource string) {
+	for _, h := range d.subscribers() {
+		if h.OnDelete != nil {
+			h.OnDelete(collection, resource)
+		}
+	}
+}
+
+func (d *Driver) subscribers() []Hooks {
+	d.hooksMutex.RLock()
+	defer d.hooksMutex.RUnlock()
+
+	hooks := make([]Hooks, 0, len(d.hooks))
+
+	for _, h := range d.hooks {
+		hooks = append(hooks, h)
+	}
+
+	return hooks
+}
+
+// pendingHooks collects the changes an operation makes, for the hooks to be
+// told about once it's over. Operations get one and defer its run before
+// taking any lock: deferred calls run last in first out, so the hooks only run
+// once the locks are released, and still hear about the changes made before an
+// operation failed part way.
+type pendingHooks struct {
+	d       *Driver
+	changes []change
+}
+
+type change struct {
+	collection string
+	resource   string
+	raw        []byte
+	deleted    bool
+}
+
+func (d *Driver) pendingHooks() *pendingHooks {
+	return &pendingHooks{d: d}
+}
+
+// write records a write of the marshalled record raw. A nil raw, for a write
+// that didn't happen, is ignored.
+func (p *pendingHooks) write(collection, resource string, raw []byte) {
+	if raw != nil {
+		p.changes = append(p.changes, change{collection: collection, resource: resource, raw: raw})
+	}
+}
+
+func (p *pendingHooks) delete(collection, resource string) {
+	p.changes = append(p.changes, change{collection: collection, resource: resource, deleted: true})
+}
+
+// run calls the hooks for the changes recorded, in order.
+func (p *pendingHooks) run() {
+	for _, c := range p.changes {
+		if c.deleted {
+			p.d.notifyDelete(c.collection, c.resource)
+		} else {
+			p.d.notifyWrite(c.collection, c.resource, c.raw)
+		}
+	}
+}
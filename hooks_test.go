@@ -0,0 +1,99 @@
+package minidb
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock tests move forward by hand.
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func TestHooks(t *testing.T) {
+	clock := newFakeClock()
+
+	tests := []struct {
+		name string
+		op   func(d *Driver) error
+		want []string
+	}{
+		{"write", func(d *Driver) error { return d.Write("users", "jane", user{Name: "jane"}) }, []string{"write users/jane"}},
+		{"delete", func(d *Driver) error { return d.Delete("users", "john") }, []string{"delete users/john"}},
+		{"rename", func(d *Driver) error { return d.Rename("users", "john", "johnny") }, []string{"delete users/john", "write users/johnny"}},
+		{"move", func(d *Driver) error { return d.MoveRecord("users", "john", "admins") }, []string{"delete users/john", "write admins/john"}},
+		{"write many", func(d *Driver) error {
+			return d.WriteMany("users", map[string]interface{}{"b": user{}, "a": user{}})
+		}, []string{"write users/a", "write users/b"}},
+		{"purge expired", func(d *Driver) error {
+			if err := d.WriteWithTTL("users", "temp", user{}, time.Minute); err != nil {
+				return err
+			}
+
+			clock.Advance(time.Hour)
+			_, err := d.PurgeExpired("users")
+
+			return err
+		}, []string{"write users/temp", "delete users/temp"}},
+		{"failed delete", func(d *Driver) error {
+			d.Delete("users", "missing")
+			return nil
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDriver(t, &Options{Clock: clock})
+
+			if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+
+			d.Subscribe(Hooks{
+				OnWrite: func(collection, resource string, raw []byte) {
+					// The lock is released by the time hooks run.
+					if _, err := d.ReadBytes(collection, resource); err != nil {
+						t.Errorf("ReadBytes from OnWrite: %v", err)
+					}
+
+					got = append(got, fmt.Sprintf("write %s/%s", collection, resource))
+				},
+				OnDelete: func(collection, resource string) {
+					got = append(got, fmt.Sprintf("delete %s/%s", collection, resource))
+				},
+			})
+
+			if err := tt.op(d); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hooks got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package minidb
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+)
+
+// createAttempts is how many names Create tries before giving up on finding
+// one that isn't taken.
+const createAttempts = 5
+
+// newUUID returns a random (version 4) UUID, the default IDGenerator.
+func newUUID() string {
+	var b [16]byte
+
+	rand.Read(b[:])
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Create writes v to a collection, like Write, under a name from the
+// IDGenerator option, and returns that name. Names already taken are skipped,
+// up to a few times.
+func (d *Driver) Create(collection string, v interface{}) (string, error) {
+	if d.closed.Load() {
+		return "", ErrClosed
+	}
+
+	if d.readOnly {
+		return "", ErrReadOnly
+	}
+
+	if collection == "" {
+		return "", missingName("Missing collection - no place to save record!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return "", err
+	}
+
+	for i := 0; i < createAttempts; i++ {
+		resource := d.canonical(d.newID())
+
+		if resource == "" {
+			return "", missingName("Missing resource - the ID generator returned no name!")
+		}
+
+		if err := d.validateName(resource); err != nil {
+			return "", err
+		}
+
+		created, err := d.create(collection, resource, v)
+		if err != nil {
+			return "", err
+		}
+
+		if created {
+			return resource, nil
+		}
+	}
+
+	return "", fmt.Errorf("unable to find a free name in collection %s after %d attempts: %w", collection, createAttempts, ErrExists)
+}
+
+// create writes v under resource unless the record exists already, and
+// reports whether it did.
+func (d *Driver) create(collection, resource string, v interface{}) (bool, error) {
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	unlock, err := d.lockRecord(context.Background(), collection, resource)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if _, _, err := d.recordFile(collection, resource); err == nil {
+		return false, nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	b, err := d.store(collection, resource, v, d.ttl)
+	if err != nil {
+		return false, err
+	}
+
+	pending.write(collection, resource, b)
+
+	return true, nil
+}
+
+// SetKeyFunc sets the func Put derives the names of a collection's records
+// from, such as a field holding the record's ID. A nil fn removes it.
+func (d *Driver) SetKeyFunc(collection string, fn func(v interface{}) (string, error)) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - unable to set key func (no name)!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return err
+	}
+
+	if fn == nil {
+		d.keyFuncs.Delete(collection)
+	} else {
+		d.keyFuncs.Store(collection, fn)
+	}
+
+	return nil
+}
+
+// Put writes v to a collection, like Write, under the name the collection's
+// key func returns for it, and fails if SetKeyFunc hasn't set one.
+func (d *Driver) Put(collection string, v interface{}) error {
+	if collection == "" {
+		return missingName("Missing collection - no place to save record!")
+	}
+
+	fn, ok := d.keyFuncs.Load(collection)
+	if !ok {
+		return fmt.Errorf("no key func set for collection %s - use SetKeyFunc, or Write with the name", collection)
+	}
+
+	resource, err := fn.(func(v interface{}) (string, error))(v)
+	if err != nil {
+		return fmt.Errorf("unable to get the name of the record: %w", err)
+	}
+
+	return d.Write(collection, resource, v)
+}
@@ -0,0 +1,102 @@
+package minidb
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestCreate(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	id, err := d.Create("users", user{Name: "john"})
+	if err != nil || !uuid.MatchString(id) {
+		t.Fatalf("Create = %s, %v; want a UUID", id, err)
+	}
+
+	var u user
+	if err := d.Read("users", id, &u); err != nil || u.Name != "john" {
+		t.Errorf("Read(%s) = %+v, %v", id, u, err)
+	}
+
+	tests := []struct {
+		name  string
+		ids   []string
+		taken bool // whether x exists already
+		want  string
+		err   error
+	}{
+		{"generated", []string{"x"}, false, "x", nil},
+		{"skips taken", []string{"x", "x", "y"}, true, "y", nil},
+		{"all taken", []string{"x"}, true, "", ErrExists},
+		{"empty", []string{""}, false, "", ErrInvalidName},
+		{"invalid", []string{"../x"}, false, "", ErrInvalidName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := 0
+			d := newTestDriver(t, &Options{IDGenerator: func() string {
+				id := tt.ids[next%len(tt.ids)]
+				next++
+				return id
+			}})
+
+			if tt.taken {
+				if err := d.Write("users", "x", user{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			id, err := d.Create("users", user{})
+			if id != tt.want || tt.err == nil && err != nil || tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Create = %q, %v; want %q, %v", id, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestPut(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Put("users", user{Name: "john"}); err == nil {
+		t.Error("Put without a key func succeeded")
+	}
+
+	err := d.SetKeyFunc("users", func(v interface{}) (string, error) {
+		u, ok := v.(user)
+		if !ok {
+			return "", fmt.Errorf("not a user: %T", v)
+		}
+		return u.Name, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Put("users", user{Name: "john", Age: 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	var u user
+	if err := d.Read("users", "john", &u); err != nil || u.Age != 30 {
+		t.Errorf("Read = %+v, %v", u, err)
+	}
+
+	for _, v := range []interface{}{"not a user", user{}, user{Name: "../x"}} {
+		if err := d.Put("users", v); err == nil {
+			t.Errorf("Put(%v) succeeded", v)
+		}
+	}
+
+	if err := d.SetKeyFunc("users", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Put("users", user{Name: "jane"}); err == nil {
+		t.Error("Put after removing the key func succeeded")
+	}
+}
@@ -0,0 +1,839 @@
+package minidb
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// indexDir is the hidden directory, inside a collection's directory, that
+// holds the collection's field indexes, one file per field.
+const indexDir = ".indexes"
+
+var ErrUniqueViolation = errors.New("unique constraint violated")
+
+// fieldIndex maps the values of one top-level field to the records holding
+// them. Values are keyed by their JSON encoding, so 23 and "23" are distinct.
+// Records without the field are kept under the empty key, so the index knows
+// every record of the collection and can tell when it has gone stale.
+type fieldIndex struct {
+	Field  string                     `json:"field"`
+	Unique bool                       `json:"unique"`
+	Values map[string]map[string]bool `json:"values"`
+
+	// byResource is the reverse of Values, used to drop a record's old value
+	// when it's rewritten or deleted.
+	byResource map[string]string
+}
+
+func newFieldIndex(field string, unique bool) *fieldIndex {
+	return &fieldIndex{
+		Field:      field,
+		Unique:     unique,
+		Values:     make(map[string]map[string]bool),
+		byResource: make(map[string]string),
+	}
+}
+
+func (idx *fieldIndex) add(resource, key string) {
+	idx.remove(resource)
+
+	if idx.Values[key] == nil {
+		idx.Values[key] = make(map[string]bool)
+	}
+
+	idx.Values[key][resource] = true
+	idx.byResource[resource] = key
+}
+
+func (idx *fieldIndex) remove(resource string) {
+	key, ok := idx.byResource[resource]
+	if !ok {
+		return
+	}
+
+	delete(idx.Values[key], resource)
+
+	if len(idx.Values[key]) == 0 {
+		delete(idx.Values, key)
+	}
+
+	delete(idx.byResource, resource)
+}
+
+// holders returns the records, other than the given ones, already holding key
+// in a unique index.
+func (idx *fieldIndex) holders(key string, except map[string][]byte) []string {
+	if !idx.Unique {
+		return nil
+	}
+
+	var others []string
+
+	for other := range idx.Values[key] {
+		if _, ok := except[other]; !ok {
+			others = append(others, other)
+		}
+	}
+
+	sort.Strings(others)
+
+	return others
+}
+
+// indexKey returns the index key of field in a marshalled record, or false if
+// the record doesn't have the field.
+func (d *Driver) indexKey(b []byte, field string) (string, bool, error) {
+	doc := map[string]interface{}{}
+
+	if err := d.codec.Unmarshal(b, &doc); err != nil {
+		return "", false, err
+	}
+
+	v, ok := doc[field]
+	if !ok {
+		return "", false, nil
+	}
+
+	key, err := json.Marshal(v)
+	if err != nil {
+		return "", false, err
+	}
+
+	return string(key), true, nil
+}
+
+// AddUniqueIndex makes writes to a collection fail with ErrUniqueViolation
+// when they'd give a record the same value of field as another record.
+// Rewriting a record with its own current value is allowed. The index is built
+// by scanning the collection once and is saved with it.
+func (d *Driver) AddUniqueIndex(collection, field string) error {
+	return d.addIndex(collection, field, true)
+}
+
+// CreateIndex indexes field across a collection so FindByField can look
+// records up by its value without reading the whole collection. The index is
+// kept up to date by the Driver's writes and deletes and saved with the
+// collection. Indexing a field that already is indexed does nothing.
+func (d *Driver) CreateIndex(collection, field string) error {
+	return d.addIndex(collection, field, false)
+}
+
+// FindByField returns the records whose top-level field equals value, in
+// record name order. Values are compared by their JSON encoding, as with the
+// index keys. Without an index on field the whole collection is scanned. An
+// index found to be out of date with the records on disk, because they were
+// changed by something other than the Driver, is rebuilt from a scan first, or
+// just bypassed by one when the database is read-only.
+func (d *Driver) FindByField(collection, field string, value interface{}) ([]string, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	if collection == "" {
+		return nil, missingName("Missing collection - no place to find records!")
+	}
+
+	if field == "" {
+		return nil, missingName("Missing field - unable to find records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return nil, err
+	}
+
+	key, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	if _, err := d.stat(collection, filepath.Join(d.dir, collection)); err != nil {
+		return nil, notFound(err)
+	}
+
+	d.indexMutex.Lock()
+
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		d.indexMutex.Unlock()
+		return nil, err
+	}
+
+	idx, ok := indexes[field]
+	if !ok {
+		d.indexMutex.Unlock()
+		return d.scanField(collection, field, string(key))
+	}
+
+	defer d.indexMutex.Unlock()
+
+	records, fresh, err := d.lookup(collection, idx, string(key))
+	if err != nil || fresh {
+		return records, err
+	}
+
+	if d.readOnly {
+		return d.scanField(collection, field, string(key))
+	}
+
+	d.log.Debug("Rebuilding stale index of %s on %s\n", collection, field)
+
+	if idx, err = d.buildIndex(collection, field, idx.Unique); err != nil {
+		return nil, err
+	}
+
+	if err := d.saveIndex(collection, idx); err != nil {
+		return nil, err
+	}
+
+	indexes[field] = idx
+
+	records, _, err = d.lookup(collection, idx, string(key))
+
+	return records, err
+}
+
+// lookup returns the records holding key in an index, or false if the index
+// turns out not to match the records on disk.
+func (d *Driver) lookup(collection string, idx *fieldIndex, key string) ([]string, bool, error) {
+	dir := filepath.Join(d.dir, collection)
+
+	files, err := d.listRecords(collection)
+	if err != nil {
+		return nil, false, err
+	}
+
+	live := make(map[string]bool, len(files))
+
+	for _, file := range files {
+		resource := d.recordName(collection, file)
+
+		if _, ok := idx.byResource[resource]; !ok {
+			return nil, false, nil
+		}
+
+		live[resource] = true
+	}
+
+	// Expired records stay indexed until they're purged.
+	for resource := range idx.byResource {
+		if !live[resource] && !d.expired(dir, resource) {
+			return nil, false, nil
+		}
+	}
+
+	records := []string{}
+
+	for _, resource := range sortedResources(idx.Values[key]) {
+		if !live[resource] {
+			continue
+		}
+
+		path, _, err := d.recordFile(collection, resource)
+		if err != nil {
+			return nil, false, err
+		}
+
+		b, err := d.readFile(path)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if k, ok, err := d.indexKey(b, idx.Field); err != nil || !ok || k != key {
+			return nil, false, nil
+		}
+
+		records = append(records, string(b))
+	}
+
+	return records, true, nil
+}
+
+// scanField is FindByField for a field without an index.
+func (d *Driver) scanField(collection, field, key string) ([]string, error) {
+	dir := filepath.Join(d.dir, collection)
+
+	files, err := d.listRecords(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []string{}
+
+	for _, file := range files {
+		b, err := d.readFile(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		k, ok, err := d.indexKey(b, field)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode record %s: %w", d.recordName(collection, file), err)
+		}
+
+		if ok && k == key {
+			records = append(records, string(b))
+		}
+	}
+
+	return records, nil
+}
+
+func (d *Driver) addIndex(collection, field string, unique bool) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to index records!")
+	}
+
+	if field == "" {
+		return missingName("Missing field - unable to index records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if err := d.fs.MkdirAll(filepath.Join(d.dir, collection), d.dirPerm); err != nil {
+		return err
+	}
+
+	d.indexMutex.Lock()
+	defer d.indexMutex.Unlock()
+
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		return err
+	}
+
+	if idx, ok := indexes[field]; ok && (idx.Unique || !unique) {
+		return nil
+	}
+
+	idx, err := d.buildIndex(collection, field, unique)
+	if err != nil {
+		return err
+	}
+
+	if err := d.saveIndex(collection, idx); err != nil {
+		return err
+	}
+
+	indexes[field] = idx
+
+	return nil
+}
+
+// buildIndex indexes field over every record of a collection, failing if a
+// unique index would be violated by the existing records.
+func (d *Driver) buildIndex(collection, field string, unique bool) (*fieldIndex, error) {
+	idx := newFieldIndex(field, unique)
+	dir := filepath.Join(d.dir, collection)
+
+	files, err := d.listRecords(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		b, err := d.readFile(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		resource := d.recordName(collection, file)
+
+		key, ok, err := d.indexKey(b, field)
+		if err != nil {
+			return nil, fmt.Errorf("unable to index record %s: %w", resource, err)
+		}
+
+		if !ok {
+			idx.add(resource, "")
+			continue
+		}
+
+		if others := idx.holders(key, nil); len(others) > 0 {
+			return nil, fmt.Errorf("%w: records %s and %s share %s %s", ErrUniqueViolation, others[0], resource, field, key)
+		}
+
+		idx.add(resource, key)
+	}
+
+	return idx, nil
+}
+
+// loadIndexes returns the indexes of a collection, reading them from disk the
+// first time. The caller must hold d.indexMutex.
+func (d *Driver) loadIndexes(collection string) (map[string]*fieldIndex, error) {
+	if indexes, ok := d.indexes[collection]; ok {
+		return indexes, nil
+	}
+
+	indexes := make(map[string]*fieldIndex)
+
+	files, err := d.fs.ReadDir(filepath.Join(d.dir, collection, indexDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		b, err := d.fs.ReadFile(filepath.Join(d.dir, collection, indexDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		idx, err := parseIndex(b)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load index %s: %w", file.Name(), err)
+		}
+
+		indexes[idx.Field] = idx
+	}
+
+	d.indexes[collection] = indexes
+
+	return indexes, nil
+}
+
+func parseIndex(b []byte) (*fieldIndex, error) {
+	idx := &fieldIndex{}
+
+	if err := json.Unmarshal(b, idx); err != nil {
+		return nil, err
+	}
+
+	idx.byResource = make(map[string]string)
+
+	if idx.Values == nil {
+		idx.Values = make(map[string]map[string]bool)
+	}
+
+	for key, resources := range idx.Values {
+		for resource := range resources {
+			idx.byResource[resource] = key
+		}
+	}
+
+	return idx, nil
+}
+
+func (d *Driver) saveIndex(collection string, idx *fieldIndex) error {
+	dir := filepath.Join(d.dir, collection, indexDir)
+
+	if err := d.fs.MkdirAll(dir, d.dirPerm); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	return d.writeFile(filepath.Join(dir, indexFileName(idx.Field)), b)
+}
+
+// indexFileName turns a field into a safe file name; fields may contain any
+// character, including path separators.
+func indexFileName(field string) string {
+	return fmt.Sprintf("%x.json", field)
+}
+
+// updateIndexes checks records about to be written to a collection against
+// its unique indexes, and returns a func that indexes the new values of those
+// that were then actually written, or nil if the collection has no indexes.
+// The caller must hold d.indexMutex.
+func (d *Driver) updateIndexes(collection string, records map[string][]byte) (func(resources ...string) error, error) {
+	indexes, err := d.loadIndexes(collection)
+	if err != nil || len(indexes) == 0 {
+		return nil, err
+	}
+
+	dir := filepath.Join(d.dir, collection)
+	keys := make(map[string]map[string]string, len(records))
+
+	resources := make([]string, 0, len(records))
+	for resource := range records {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	for field, idx := range indexes {
+		claimed := map[string]string{}
+
+		for _, resource := range resources {
+			key, ok, err := d.indexKey(records[resource], field)
+			if err != nil {
+				return nil, fmt.Errorf("unable to index record %s: %w", resource, err)
+			}
+
+			if !ok {
+				continue
+			}
+
+			if idx.Unique {
+				if other, ok := claimed[key]; ok {
+					return nil, fmt.Errorf("%w: records %s and %s share %s %s", ErrUniqueViolation, other, resource, field, key)
+				}
+
+				// Expired records keep their values until they're purged, but
+				// no longer hold them against new ones.
+				for _, other := range idx.holders(key, records) {
+					if !d.expired(dir, other) {
+						return nil, fmt.Errorf("%w: %s %s is already used by record %s", ErrUniqueViolation, field, key, other)
+					}
+				}
+
+				claimed[key] = resource
+			}
+
+			if keys[resource] == nil {
+				keys[resource] = map[string]string{}
+			}
+
+			keys[resource][field] = key
+		}
+	}
+
+	commit := func(written ...string) error {
+		for field, idx := range indexes {
+			for _, resource := range written {
+				idx.add(resource, keys[resource][field])
+			}
+
+			if err := d.saveIndex(collection, idx); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return commit, nil
+}
+
+// renameIndexed moves the index entries of a record to its new name.
+func (d *Driver) renameIndexed(collection, oldResource, newResource string) error {
+	d.indexMutex.Lock()
+	defer d.indexMutex.Unlock()
+
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range indexes {
+		key, ok := idx.byResource[oldResource]
+
+		idx.remove(oldResource)
+		idx.remove(newResource)
+
+		if ok {
+			idx.add(newResource, key)
+		}
+
+		if err := d.saveIndex(collection, idx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unindex drops records from the indexes of a collection.
+func (d *Driver) unindex(collection string, resources ...string) error {
+	d.indexMutex.Lock()
+	defer d.indexMutex.Unlock()
+
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		return err
+	}
+
+	for _, idx := range indexes {
+		for _, resource := range resources {
+			idx.remove(resource)
+		}
+
+		if err := d.saveIndex(collection, idx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebuildIndexes rebuilds every index of a collection from a scan, for when
+// its records changed behind the indexes' back.
+func (d *Driver) rebuildIndexes(collection string) error {
+	d.indexMutex.Lock()
+	defer d.indexMutex.Unlock()
+
+	indexes, err := d.loadIndexes(collection)
+	if err != nil {
+		return err
+	}
+
+	for field, idx := range indexes {
+		rebuilt, err := d.buildIndex(collection, field, idx.Unique)
+		if err != nil {
+			return err
+		}
+
+		if err := d.saveIndex(collection, rebuilt); err != nil {
+			return err
+		}
+
+		indexes[field] = rebuilt
+	}
+
+	return nil
+}
+
+// RebuildIndexes throws the indexes of a collection away, in memory and on
+// disk, and builds them again from a scan of its records. Index files too
+// damaged to tell whether they were unique are rebuilt as non-unique;
+// AddUniqueIndex makes them unique again.
+func (d *Driver) RebuildIndexes(collection string) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to index records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if _, err := d.stat(collection, filepath.Join(d.dir, collection)); err != nil {
+		return notFound(err)
+	}
+
+	d.indexMutex.Lock()
+	defer d.indexMutex.Unlock()
+
+	delete(d.indexes, collection)
+
+	stored, err := d.readIndexFiles(collection)
+	if err != nil {
+		return err
+	}
+
+	indexes := make(map[string]*fieldIndex)
+
+	for field, s := range stored {
+		if s.err != nil {
+			d.log.Warn("Index of %s on %s is unreadable, rebuilding it as non-unique: %s\n", collection, field, s.err)
+		}
+
+		idx, err := d.buildIndex(collection, field, s.err == nil && s.idx.Unique)
+		if err != nil {
+			return err
+		}
+
+		if err := d.saveIndex(collection, idx); err != nil {
+			return err
+		}
+
+		indexes[field] = idx
+	}
+
+	d.indexes[collection] = indexes
+
+	return nil
+}
+
+// CheckIndexes compares the indexes of a collection, as saved on disk, with
+// its records, and describes every discrepancy found, such as a record
+// missing from an index or indexed under a value it doesn't hold. Nothing is
+// changed; RebuildIndexes fixes them.
+func (d *Driver) CheckIndexes(collection string) ([]string, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	if collection == "" {
+		return nil, missingName("Missing collection - no place to check indexes!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	if _, err := d.stat(collection, dir); err != nil {
+		return nil, notFound(err)
+	}
+
+	d.indexMutex.Lock()
+	defer d.indexMutex.Unlock()
+
+	stored, err := d.readIndexFiles(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(stored))
+	for field := range stored {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var problems []string
+
+	for _, field := range fields {
+		s := stored[field]
+
+		if s.err != nil {
+			problems = append(problems, fmt.Sprintf("index on %s: unreadable: %s", field, s.err))
+			continue
+		}
+
+		want, err := d.buildIndex(collection, field, s.idx.Unique)
+		if errors.Is(err, ErrUniqueViolation) {
+			problems = append(problems, fmt.Sprintf("index on %s: %s", field, err))
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, resource := range sortedKeys(want.byResource) {
+			key, ok := s.idx.byResource[resource]
+
+			switch {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("index on %s: record %s is missing", field, resource))
+			case key != want.byResource[resource]:
+				problems = append(problems, fmt.Sprintf("index on %s: record %s is indexed under %q but holds %q", field, resource, key, want.byResource[resource]))
+			}
+		}
+
+		// Expired records stay indexed until they're purged.
+		for _, resource := range sortedKeys(s.idx.byResource) {
+			if _, ok := want.byResource[resource]; !ok && !d.expired(dir, resource) {
+				problems = append(problems, fmt.Sprintf("index on %s: record %s doesn't exist", field, resource))
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// storedIndex is an index as read from its file, or the error reading it.
+type storedIndex struct {
+	idx *fieldIndex
+	err error
+}
+
+// readIndexFiles reads the index files of a collection, keyed by the field
+// they index, which is taken from the file name so that it's known even for
+// files that can't be parsed.
+func (d *Driver) readIndexFiles(collection string) (map[string]storedIndex, error) {
+	dir := filepath.Join(d.dir, collection, indexDir)
+
+	files, err := d.fs.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	stored := make(map[string]storedIndex)
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		field, err := hex.DecodeString(strings.TrimSuffix(file.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+
+		b, err := d.fs.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		idx, err := parseIndex(b)
+		if err == nil && idx.Field != string(field) {
+			err = fmt.Errorf("holds the index on %s", idx.Field)
+		}
+
+		stored[string(field)] = storedIndex{idx, err}
+	}
+
+	return stored, nil
+}
+
+// forgetIndexes drops the in-memory indexes of a collection, so they're
+// loaded from disk again the next time they're needed.
+func (d *Driver) forgetIndexes(collection string) {
+	d.indexMutex.Lock()
+	delete(d.indexes, collection)
+	d.indexMutex.Unlock()
+}
+
+// sortedKeys returns the keys of a map in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// sortedResources returns the records of a set in name order.
+func sortedResources(set map[string]bool) []string {
+	resources := make([]string, 0, len(set))
+
+	for resource := range set {
+		resources = append(resources, resource)
+	}
+
+	sort.Strings(resources)
+
+	return resources
+}
@@ -0,0 +1,195 @@
+package minidb
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUniqueIndex(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.AddUniqueIndex("users", "Name"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		op   func() error
+		want error
+	}{
+		{"other value", func() error { return d.Write("users", "jane", user{Name: "jane"}) }, nil},
+		{"taken value", func() error { return d.Write("users", "johnny", user{Name: "john"}) }, ErrUniqueViolation},
+		{"own value", func() error { return d.Write("users", "john", user{Name: "john", Age: 1}) }, nil},
+		{"within a batch", func() error {
+			return d.WriteMany("users", map[string]interface{}{"a": user{Name: "x"}, "b": user{Name: "x"}})
+		}, ErrUniqueViolation},
+		{"rename keeps value", func() error { return d.Rename("users", "john", "johnny") }, nil},
+		{"freed by delete", func() error {
+			if err := d.Delete("users", "johnny"); err != nil {
+				return err
+			}
+			return d.Write("users", "bob", user{Name: "john"})
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		err := tt.op()
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if problems, err := d.CheckIndexes("users"); err != nil || len(problems) > 0 {
+		t.Errorf("CheckIndexes = %v, %v", problems, err)
+	}
+
+	// A field already holding duplicates can't be made unique.
+	if err := d.Write("users", "carl", user{Name: "carl", Company: "acme"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "dave", user{Name: "dave", Company: "acme"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.AddUniqueIndex("users", "Company"); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("AddUniqueIndex over duplicates = %v, want ErrUniqueViolation", err)
+	}
+}
+
+func TestFindByField(t *testing.T) {
+	records := map[string]interface{}{
+		"a": map[string]interface{}{"Name": "a", "State": "NY", "Age": 23},
+		"b": map[string]interface{}{"Name": "b", "State": "CA", "Age": "23"},
+		"c": map[string]interface{}{"Name": "c", "State": "NY"},
+	}
+
+	tests := []struct {
+		field string
+		value interface{}
+		want  []string
+	}{
+		{"State", "NY", []string{"a", "c"}},
+		{"State", "TX", nil},
+		{"Age", 23, []string{"a"}},
+		{"Age", "23", []string{"b"}},
+		{"Missing", "x", nil},
+	}
+
+	for _, indexed := range []bool{false, true} {
+		d := newTestDriver(t, nil)
+
+		if err := d.WriteMany("users", records); err != nil {
+			t.Fatal(err)
+		}
+
+		if indexed {
+			for _, field := range []string{"State", "Age"} {
+				if err := d.CreateIndex("users", field); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		for _, tt := range tests {
+			found, err := d.FindByField("users", tt.field, tt.value)
+			got := names(t, found)
+			if err != nil || len(got) != len(tt.want) || len(got) > 0 && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("indexed %v: FindByField(%s, %v) = %v, %v; want %v", indexed, tt.field, tt.value, got, err, tt.want)
+			}
+		}
+
+		if _, err := d.FindByField("missing", "State", "NY"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("FindByField(missing) = %v, want ErrNotFound", err)
+		}
+	}
+}
+
+func TestStaleIndex(t *testing.T) {
+	dir := t.TempDir()
+	d := newTestDriverAt(t, dir, nil)
+
+	if err := d.CreateIndex("users", "State"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "a", user{State: "NY"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process adds a record behind the Driver's back.
+	if err := os.WriteFile(filepath.Join(dir, "users", "b.json"), []byte(`{"State": "NY"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := d.CheckIndexes("users")
+	if err != nil || len(problems) != 1 {
+		t.Errorf("CheckIndexes = %v, %v; want one problem", problems, err)
+	}
+
+	if found, err := d.FindByField("users", "State", "NY"); err != nil || len(found) != 2 {
+		t.Errorf("FindByField = %v, %v; the stale index must be rebuilt", found, err)
+	}
+
+	if problems, err := d.CheckIndexes("users"); err != nil || len(problems) > 0 {
+		t.Errorf("CheckIndexes after the rebuild = %v, %v", problems, err)
+	}
+
+	// A damaged index file is rebuilt as non-unique.
+	if err := os.WriteFile(filepath.Join(dir, "users", "b.json"), []byte(`{"State": "CA"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "users", indexDir, "*"))
+	for _, file := range files {
+		if err := os.WriteFile(file, []byte("garbage"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if problems, err := d.CheckIndexes("users"); err != nil || len(problems) == 0 {
+		t.Errorf("CheckIndexes of a damaged index = %v, %v", problems, err)
+	}
+
+	if err := d.RebuildIndexes("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	if found, err := d.FindByField("users", "State", "CA"); err != nil || len(found) != 1 {
+		t.Errorf("FindByField after RebuildIndexes = %v, %v", found, err)
+	}
+
+	// Indexes are saved with the collection.
+	d.Close()
+	d = newTestDriverAt(t, dir, nil)
+
+	if problems, err := d.CheckIndexes("users"); err != nil || len(problems) > 0 {
+		t.Errorf("CheckIndexes after reopening = %v, %v", problems, err)
+	}
+}
+
+// names returns the Name fields of records, in order.
+func names(t *testing.T, records []string) []string {
+	t.Helper()
+
+	var names []string
+
+	for _, record := range records {
+		var u struct{ Name string }
+		if err := json.Unmarshal([]byte(record), &u); err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, u.Name)
+	}
+
+	return names
+}
@@ -0,0 +1,108 @@
+package minidb
+
+import "context"
+
+// Lock takes the collection lock exclusively and returns the func releasing
+// it, so several operations on the collection can be made atomic with respect
+// to everything else going through the Driver. While holding it, use
+// ReadLocked and WriteLocked: every other method that touches the collection
+// takes its lock too and deadlocks, as do Each callbacks and hooks reaching
+// for it. Locks on several collections must be taken in name order, like the
+// Driver does, or two callers can deadlock each other. Nothing is locked if
+// the Driver is closed or the collection name is invalid.
+func (d *Driver) Lock(collection string) (func(), error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+
+	return mutex.Unlock, nil
+}
+
+// ReadLocked is Read for a caller holding the collection's Lock.
+func (d *Driver) ReadLocked(collection, resource string, v interface{}) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to read record!")
+	}
+
+	if resource == "" {
+		return missingName("Missing resource - unable to read record (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return err
+	}
+
+	resource = d.canonical(resource)
+
+	b, err := d.readLocked(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	return d.codec.Unmarshal(b, v)
+}
+
+// WriteLocked is Write for a caller holding the collection's Lock. Hooks are
+// called before it returns, with the lock still held.
+func (d *Driver) WriteLocked(collection, resource string, v interface{}) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to save record!")
+	}
+
+	if resource == "" {
+		return missingName("Missing resource - unable to save record (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return err
+	}
+
+	resource = d.canonical(resource)
+
+	b, err := d.store(collection, resource, v, d.ttl)
+	if err != nil {
+		return err
+	}
+
+	d.notifyWrite(collection, resource, b)
+
+	return nil
+}
+
+// acquireIO waits for a turn with MaxConcurrentIO, unless ctx is done first,
+// and returns the func that ends it.
+func (d *Driver) acquireIO(ctx context.Context) (func(), error) {
+	if d.ioSlots == nil {
+		return func() {}, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	select {
+	case d.ioSlots <- struct{}{}:
+		return func() { <-d.ioSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -1,11 +1,24 @@
-package main
+package minidb
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/cipher"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jcelliott/lumber"
 )
@@ -13,6 +26,44 @@ import (
 
 const Version = "1.0.0"
 
+// defaultMaxNameLength is the default MaxNameLength.
+const defaultMaxNameLength = 200
+
+var (
+	ErrNotFound = errors.New("record not found")
+	ErrClosed   = errors.New("database is closed")
+	ErrExists   = errors.New("record already exists")
+
+	// ErrInvalidName is wrapped by the errors for collection and resource names
+	// that can't be stored.
+	ErrInvalidName = errors.New("invalid name")
+
+	ErrReadOnly = errors.New("database is read-only")
+
+	// ErrLockTimeout is returned by WriteWithTimeout when the collection lock
+	// isn't acquired in time.
+	ErrLockTimeout = errors.New("timed out waiting for the collection lock")
+
+	// ErrNameTooLong is returned for collection and resource names longer
+	// than MaxNameLength.
+	ErrNameTooLong = errors.New("name too long")
+
+	// ErrRecordTooLarge is returned by writes of records over MaxRecordBytes.
+	ErrRecordTooLarge = errors.New("record too large")
+)
+
+// missingName is the error for a collection or resource name left empty. It
+// matches ErrInvalidName.
+type missingName string
+
+func (e missingName) Error() string {
+	return string(e)
+}
+
+func (e missingName) Is(target error) bool {
+	return target == ErrInvalidName
+}
+
 type (
 	Logger interface {
 		Fatal(string, ...interface{}) // variadic function
@@ -25,14 +76,202 @@ type (
 
 	Driver struct {
 		mutex sync.Mutex
-		mutexes map[string]*sync.Mutex
+		mutexes map[string]*sync.RWMutex
+		closed atomic.Bool
+		counters counters
+		readOnly bool
 		dir string
+		fs FileSystem
+		dirPerm os.FileMode
+		filePerm os.FileMode
 		log Logger
+		recordLocks bool
+		stripes [256]sync.Mutex
+		allowOverwrite bool
+		hooksMutex sync.RWMutex
+		hooks map[int]Hooks
+		nextHook int
+		compress bool
+		noTrailingNewline bool
+		shardDepth int
+		softDelete bool
+		caseInsensitive bool
+		durability Durability
+		syncer *syncer
+		retryPolicy RetryPolicy
+		wal bool
+		walMutex sync.Mutex
+		aead cipher.AEAD
+		cache *lruCache
+		schemas sync.Map
+		collectionOpts sync.Map
+		keyFuncs sync.Map
+		indexMutex sync.Mutex
+		indexes map[string]map[string]*fieldIndex
+		ttl time.Duration
+		clock Clock
+		tracer Tracer
+		slowThreshold time.Duration
+		maxRecordBytes int
+		maxNameLength int
+		ioSlots chan struct{}
+		newID func() string
+		codec Codec
+		ext string
 	}
 )
 
 type Options struct {
 	Logger
+
+	// RecordLocks lets writes to different records of the same collection run
+	// in parallel. Single-record writes then share the collection lock and
+	// serialize on a per-record lock instead, while operations spanning the
+	// whole collection still take it exclusively.
+	RecordLocks bool
+
+	// OnWrite and OnDelete are registered as the first subscriber, see
+	// Subscribe.
+	OnWrite func(collection, resource string, raw []byte)
+	OnDelete func(collection, resource string)
+
+	// AllowOverwrite lets Rename replace an existing destination record
+	// instead of failing with ErrExists.
+	AllowOverwrite bool
+
+	// CacheSize is the number of records kept in an in-memory LRU cache for
+	// Read. Writes and deletes made through the Driver keep it up to date,
+	// but changes made to the files by other processes are not noticed until
+	// a cached record is evicted. Zero disables the cache.
+	CacheSize int
+
+	// Codec controls how records are serialized and the extension they are
+	// stored under. Defaults to JSONCodec.
+	Codec Codec
+
+	// CompactJSON writes JSON records without indentation, trading human
+	// readability for smaller files and faster writes.
+	CompactJSON bool
+
+	// CanonicalJSON writes JSON records with the keys of every object sorted,
+	// struct fields included, so that equal records are stored as the same
+	// bytes whatever type they were written from.
+	CanonicalJSON bool
+
+	// NoTrailingNewline stores records exactly as the Codec marshals them,
+	// instead of ending them with a newline. Only JSONCodec and YAMLCodec
+	// records get one either way.
+	NoTrailingNewline bool
+
+	// FileExtension overrides the extension records are stored under, for
+	// interop with tools that expect something other than the Codec's.
+	FileExtension string
+
+	// Compress gzips records on Write and adds ".gz" to their extension. Records
+	// are read back either way, so it can be switched on for an existing
+	// database; each record is converted the next time it is written.
+	Compress bool
+
+	// TTL makes records written by Write, WriteBatch, or created by Upsert
+	// expire after the given duration; WriteWithTTL overrides it per record.
+	// See PurgeExpired for how expired records are cleaned up.
+	TTL time.Duration
+
+	// EncryptionKey, when set, encrypts every record at rest with AES-GCM. It
+	// must be 16, 24 or 32 bytes long. Records written with one key can only
+	// be read back with that same key, so changing it makes existing data
+	// unreadable; there is no key rotation yet.
+	EncryptionKey []byte
+
+	// CompactOnOpen runs Compact on every existing collection when the
+	// database is opened.
+	CompactOnOpen bool
+
+	// ReadOnly makes every method that would change the database fail with
+	// ErrReadOnly before touching the filesystem. The directory must then
+	// already exist.
+	ReadOnly bool
+
+	// DirPerm and FilePerm are the permissions directories and files are
+	// created with, before the umask is applied. They default to 0755 and
+	// 0644.
+	DirPerm os.FileMode
+	FilePerm os.FileMode
+
+	// WAL makes WriteBatch crash-safe: the batch is logged before its records
+	// are renamed into place, and New completes a batch that was interrupted
+	// by a crash. It costs an fsync per record and one for the log.
+	WAL bool
+
+	// Clock is where the Driver gets the time from, for record expiry and
+	// anything else time-based. Defaults to the system clock.
+	Clock Clock
+
+	// ShardDepth spreads the records of each collection over levels of
+	// subdirectories named after a hash of the record name, such as
+	// "users/ab/cd/john.json" for a depth of 2, which keeps directories small
+	// for huge collections. It can be at most 4, and defaults to 0, the flat
+	// layout. Records are only found in the layout they were written with, so
+	// it must not be changed for an existing database.
+	ShardDepth int
+
+	// SoftDelete makes Delete move records into a trash directory instead of
+	// removing them, from where Undelete can bring them back. Nothing leaves
+	// the trash until EmptyTrash is called. Deleting a whole collection is
+	// never soft. The trash is named ".trash", which is why no collection or
+	// resource name may start with a dot.
+	SoftDelete bool
+
+	// CaseInsensitiveKeys lower-cases resource names before using them, so
+	// "John" and "john" are the same record everywhere, rather than only on
+	// case-insensitive filesystems. Records are listed under their
+	// lower-cased names. Names of records written without it that aren't
+	// lower case become unreachable, so it must not be turned on for an
+	// existing database holding such records.
+	CaseInsensitiveKeys bool
+
+	// IDGenerator returns the names Create stores records under. Defaults
+	// to random UUIDs.
+	IDGenerator func() string
+
+	// Durability controls whether written files are flushed to disk, and
+	// when. Defaults to DurabilityNone. With DurabilityBatched, SyncInterval
+	// is how often they are, one second by default.
+	Durability Durability
+	SyncInterval time.Duration
+
+	// Retry retries reading and writing record files on transient errors.
+	// By default nothing is retried.
+	Retry RetryPolicy
+
+	// Tracer, when set, traces reads, writes and deletes.
+	Tracer Tracer
+
+	// MaxNameLength is the longest collection or resource name accepted, in
+	// bytes. It defaults to 200, leaving room under the 255 bytes most
+	// filesystems allow for a file name for the extension and the suffixes of
+	// temporary and metadata files.
+	MaxNameLength int
+
+	// MaxRecordBytes, when set, makes writes fail with ErrRecordTooLarge for
+	// records that marshal to more bytes than it, before anything is written.
+	// WriteStream gives up as soon as it has read more than that.
+	MaxRecordBytes int
+
+	// MaxConcurrentIO, when set, bounds how many reads and writes of single
+	// records, and ReadAlls, touch the filesystem at once, to stay clear of
+	// the process's open files limit. The rest wait their turn, or give up
+	// once their context is done.
+	MaxConcurrentIO int
+
+	// SlowThreshold, when set, logs a warning for every read, write or delete
+	// taking longer than it, the wait for the lock included. It covers the
+	// same calls as Tracer.
+	SlowThreshold time.Duration
+
+	// FileSystem is where the database's files are kept, the operating
+	// system's by default. The watch package only works with the default.
+	FileSystem FileSystem
 }
 
 func New(dir string, options *Options)(*Driver, error) {
@@ -48,219 +287,2475 @@ func New(dir string, options *Options)(*Driver, error) {
 		opts.Logger = lumber.NewConsoleLogger(lumber.INFO)
 	}
 
+	if opts.Codec == nil {
+		opts.Codec = JSONCodec{}
+	}
+
+	if c, ok := opts.Codec.(JSONCodec); ok && (opts.CompactJSON || opts.CanonicalJSON) {
+		c.Compact = c.Compact || opts.CompactJSON
+		c.Canonical = c.Canonical || opts.CanonicalJSON
+		opts.Codec = c
+	}
+
+	if opts.ShardDepth < 0 || opts.ShardDepth > maxShardDepth {
+		return nil, fmt.Errorf("invalid shard depth %d - must be between 0 and %d", opts.ShardDepth, maxShardDepth)
+	}
+
+	if opts.FileSystem == nil {
+		opts.FileSystem = osFS{}
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = realClock{}
+	}
+
+	if opts.IDGenerator == nil {
+		opts.IDGenerator = newUUID
+	}
+
+	if opts.DirPerm == 0 {
+		opts.DirPerm = 0755
+	}
+
+	if opts.FilePerm == 0 {
+		opts.FilePerm = 0644
+	}
+
+	if opts.MaxNameLength <= 0 {
+		opts.MaxNameLength = defaultMaxNameLength
+	}
+
+	if opts.FileExtension == "" {
+		opts.FileExtension = opts.Codec.Extension()
+	}
+
+	if !strings.HasPrefix(opts.FileExtension, ".") {
+		opts.FileExtension = "." + opts.FileExtension
+	}
+
+	var aead cipher.AEAD
+
+	if opts.EncryptionKey != nil {
+		var err error
+		if aead, err = newAEAD(opts.EncryptionKey); err != nil {
+			return nil, fmt.Errorf("invalid encryption key: %w", err)
+		}
+	}
+
+	if fi, err := opts.FileSystem.Stat(dir); err == nil && !fi.IsDir() {
+		return nil, fmt.Errorf("unable to open database at %s: path exists and is not a directory", dir)
+	}
+
 	driver := Driver{
 		dir: dir,
-		mutexes: make(map[string]*sync.Mutex),
+		fs: opts.FileSystem,
+		dirPerm: opts.DirPerm,
+		filePerm: opts.FilePerm,
+		mutexes: make(map[string]*sync.RWMutex),
 		log: opts.Logger,
+		recordLocks: opts.RecordLocks,
+		allowOverwrite: opts.AllowOverwrite,
+		readOnly: opts.ReadOnly,
+		hooks: make(map[int]Hooks),
+		compress: opts.Compress,
+		noTrailingNewline: opts.NoTrailingNewline,
+		shardDepth: opts.ShardDepth,
+		softDelete: opts.SoftDelete,
+		caseInsensitive: opts.CaseInsensitiveKeys,
+		durability: opts.Durability,
+		retryPolicy: opts.Retry,
+		wal: opts.WAL,
+		aead: aead,
+		cache: newLRUCache(opts.CacheSize, opts.Clock),
+		indexes: make(map[string]map[string]*fieldIndex),
+		ttl: opts.TTL,
+		clock: opts.Clock,
+		tracer: opts.Tracer,
+		slowThreshold: opts.SlowThreshold,
+		maxRecordBytes: opts.MaxRecordBytes,
+		maxNameLength: opts.MaxNameLength,
+		newID: opts.IDGenerator,
+		codec: opts.Codec,
+		ext: opts.FileExtension,
+	}
+
+	if opts.MaxConcurrentIO > 0 {
+		driver.ioSlots = make(chan struct{}, opts.MaxConcurrentIO)
+	}
+
+	if opts.Durability == DurabilityBatched && !opts.ReadOnly {
+		if opts.SyncInterval <= 0 {
+			opts.SyncInterval = defaultSyncInterval
+		}
+
+		driver.syncer = newSyncer(opts.SyncInterval, driver.sync, opts.Logger)
 	}
 
-	if _, err := os.Stat(dir); err == nil {
+	if opts.OnWrite != nil || opts.OnDelete != nil {
+		driver.Subscribe(Hooks{OnWrite: opts.OnWrite, OnDelete: opts.OnDelete})
+	}
+
+	_, err := driver.fs.Stat(dir)
+	if err == nil {
 		opts.Logger.Debug("Using '%s' (database already exists) \n", dir)
+
+		if opts.ReadOnly {
+			return &driver, nil
+		}
+
+		if err := driver.probeWritable(); err != nil {
+			return &driver, err
+		}
+
+		if err := driver.recoverReclaims(); err != nil {
+			return &driver, fmt.Errorf("unable to recover interrupted reclaims: %w", err)
+		}
+
+		if err := driver.replayLog(); err != nil {
+			return &driver, fmt.Errorf("unable to replay %s: %w", walFile, err)
+		}
+
+		if opts.CompactOnOpen {
+			return &driver, driver.compactAll()
+		}
+
 		return &driver, nil
 	}
 
+	if opts.ReadOnly {
+		return nil, fmt.Errorf("unable to open database read-only: %w", err)
+	}
+
 	opts.Logger.Debug("Creating '%s' (database does not exist) \n", dir)
-	return &driver, os.MkdirAll(dir, 0755)
+
+	if err := driver.fs.MkdirAll(dir, driver.dirPerm); err != nil {
+		return &driver, err
+	}
+
+	return &driver, driver.probeWritable()
+}
+
+// probeWritable creates and removes a file in the database directory, so that
+// a database that can't be written to is reported by New rather than by the
+// first write.
+func (d *Driver) probeWritable() error {
+	probe := filepath.Join(d.dir, ".probe-"+newUUID())
+
+	err := d.fs.WriteFile(probe, nil, d.filePerm)
+	if err == nil {
+		err = d.fs.Remove(probe)
+	}
+
+	if err != nil {
+		return fmt.Errorf("database directory %s is not writable: %w", d.dir, err)
+	}
+
+	return nil
 }
 
 func (d *Driver) Write(collection string, resource string, v interface{}) error {
+	return d.WriteContext(context.Background(), collection, resource, v)
+}
+
+func (d *Driver) WriteContext(ctx context.Context, collection string, resource string, v interface{}) (err error) {
+	ctx, end := d.instrument(ctx, "Write", collection, resource)
+	defer func() { end(err) }()
+
+	return d.write(ctx, collection, resource, v, d.ttl)
+}
+
+// WriteWithTTL is Write with an expiry overriding Options.TTL. A ttl of zero
+// stores the record without one.
+func (d *Driver) WriteWithTTL(collection, resource string, v interface{}, ttl time.Duration) (err error) {
+	ctx, end := d.instrument(context.Background(), "Write", collection, resource)
+	defer func() { end(err) }()
+
+	return d.write(ctx, collection, resource, v, ttl)
+}
+
+// WriteWithTimeout is Write giving up with ErrLockTimeout if the lock it needs,
+// or its turn with MaxConcurrentIO, isn't acquired within timeout, rather than
+// queueing behind a slow writer.
+func (d *Driver) WriteWithTimeout(collection, resource string, v interface{}, timeout time.Duration) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ctx, end := d.instrument(ctx, "Write", collection, resource)
+	defer func() { end(err) }()
+
+	err = d.write(ctx, collection, resource, v, d.ttl)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrLockTimeout, err)
+	}
+
+	return err
+}
+
+func (d *Driver) write(ctx context.Context, collection string, resource string, v interface{}, ttl time.Duration) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
   if collection == "" {
-		return fmt.Errorf("Missing collection - no place to save record!")
+		return missingName("Missing collection - no place to save record!")
 	}
 
 	if resource == "" {
-		return fmt.Errorf("Missing resource - unable to save record (no name)!")
+		return missingName("Missing resource - unable to save record (no name)!")
 	}
 
-	mutex := d.getOrCreateMutex(collection)
-	mutex.Lock()
-	defer mutex.Unlock() // unlock mutex after function returns
+	if err := d.validateName(collection, resource); err != nil {
+		return err
+	}
 
-	dir := filepath.Join(d.dir, collection)
-	fnlPath := filepath.Join(dir, resource + ".json")
-	tmpPath := fnlPath + ".tmp"
+	resource = d.canonical(resource)
 
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	release, err := d.acquireIO(ctx)
+	if err != nil {
 		return err
 	}
 
-	b, err := json.MarshalIndent(v, "", "\t")
+	unlock, err := d.lockRecord(ctx, collection, resource)
 	if err != nil {
+		release()
 		return err
 	}
 
-	b = append(b, byte('\n'))
+	b, err := d.store(collection, resource, v, ttl)
+	unlock()
+	release()
 
-	if err := os.WriteFile(tmpPath, b, 0644); err != nil {
+	if err != nil {
 		return err
 	}
 
-	return os.Rename(tmpPath, fnlPath)
+	d.notifyWrite(collection, resource, b)
+
+	return nil
 }
 
-func (d *Driver) Read(collection, resource string, v interface{}) error {
-  if collection == "" {
-		return fmt.Errorf("Missing collection - no place to read record!")
+// ValidateWrite reports the error Write would fail with for the record, from
+// marshalling it to checking it against the collection's schema and unique
+// indexes, without writing anything or taking the collection lock. A record
+// that passes can still be rejected by Write if the collection changes first.
+func (d *Driver) ValidateWrite(collection, resource string, v interface{}) error {
+	if d.closed.Load() {
+		return ErrClosed
 	}
 
-	if resource == "" {
-		return fmt.Errorf("Missing resource - unable to read record (no name)!")
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to save record!")
 	}
 
-	record := filepath.Join(d.dir, collection, resource + ".json")
+	if resource == "" {
+		return missingName("Missing resource - unable to save record (no name)!")
+	}
 
-	if _, err := stat(record); err != nil {
+	if err := d.validateName(collection, resource); err != nil {
 		return err
 	}
 
-	b, err := os.ReadFile(record)
+	resource = d.canonical(resource)
+
+	b, err := d.marshal(collection, v)
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(b, &v)
+	if err := d.checkWritable(collection, resource, b); err != nil {
+		return err
+	}
+
+	d.indexMutex.Lock()
+	defer d.indexMutex.Unlock()
+
+	_, err = d.updateIndexes(collection, map[string][]byte{resource: b})
+
+	return err
 }
 
-func (d *Driver) ReadAll(collection string)([]string, error) {
-  if collection == "" {
-		return nil, fmt.Errorf("Missing collection - no place to read records!")
+// store marshals and saves a record, expiring after ttl, and returns the
+// marshalled bytes. The caller must hold the record's lock.
+func (d *Driver) store(collection, resource string, v interface{}, ttl time.Duration) ([]byte, error) {
+	dir := filepath.Join(d.dir, collection)
+
+	if err := d.fs.MkdirAll(dir, d.dirPerm); err != nil {
+		return nil, err
 	}
 
-	dir := filepath.Join(d.dir, collection)
+	b, err := d.marshal(collection, v)
+	if err != nil {
+		return nil, err
+	}
 
-	if _, err := stat(dir); err != nil {
+	if err := d.writeRecord(collection, resource, b); err != nil {
 		return nil, err
 	}
 
-	files, _ := os.ReadDir(dir)
+	err = d.updateMeta(collection, resource, func(m *recordMeta) {
+		m.setTTL(ttl, d.clock.Now())
+		m.bump()
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	var records []string
+	return b, nil
+}
 
-	for _, file := range files {
-		b, err := os.ReadFile(filepath.Join(dir, file.Name()))
+// WriteMany writes several records of a collection while taking the
+// collection lock only once. Unlike WriteBatch, records are saved one after
+// the other, so an error leaves the records before it written.
+func (d *Driver) WriteMany(collection string, records map[string]interface{}) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
 
-		if err != nil {
-			return nil, err
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to save records!")
+	}
+
+	records, err := d.canonicalRecords(records)
+	if err != nil {
+		return err
+	}
+
+	resources := make([]string, 0, len(records))
+
+	for resource := range records {
+		if resource == "" {
+			return missingName("Missing resource - unable to save record (no name)!")
 		}
 
-		records = append(records, string(b))
+		if err := d.validateName(collection, resource); err != nil {
+			return err
+		}
+
+		resources = append(resources, resource)
 	}
 
-	return records, nil
-}
+	sort.Strings(resources)
+
+	pending := d.pendingHooks()
+	defer pending.run()
 
-func (d *Driver) Delete(collection, resource string) error {
-	path := filepath.Join(d.dir, collection, resource)
 	mutex := d.getOrCreateMutex(collection)
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	dir := filepath.Join(d.dir, path)
+	for _, resource := range resources {
+		b, err := d.store(collection, resource, records[resource], d.ttl)
+		if err != nil {
+			return fmt.Errorf("unable to save record %s: %w", resource, err)
+		}
 
-	switch fi, err := stat(dir); {
-		case fi == nil, err != nil:
-			return fmt.Errorf("unable to find file or directory named: %s", path)
-		case fi.Mode().IsDir():
-			return os.RemoveAll(dir)
-		case fi.Mode().IsRegular():
-			return os.RemoveAll(dir + ".json")
+		pending.write(collection, resource, b)
 	}
 
 	return nil
 }
 
-func (d *Driver) getOrCreateMutex(collection string) *sync.Mutex {
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
-  m, ok := d.mutexes[collection]
+// ReadMany reads the given records of a collection in a single locked pass.
+// Records that don't exist are left out of the result rather than failing the
+// whole call.
+func (d *Driver) ReadMany(collection string, resources []string) (map[string][]byte, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
 
-	if !ok {
-		m = &sync.Mutex{}
-		d.mutexes[collection] = m
+	if collection == "" {
+		return nil, missingName("Missing collection - no place to read records!")
 	}
 
-	return m
+	if err := d.validateName(collection); err != nil {
+		return nil, err
+	}
+
+	for _, resource := range resources {
+		if resource == "" {
+			return nil, missingName("Missing resource - unable to read record (no name)!")
+		}
+
+		if err := d.validateName(resource); err != nil {
+			return nil, err
+		}
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	records := make(map[string][]byte, len(resources))
+
+	for _, resource := range resources {
+		record, _, err := d.recordFile(collection, d.canonical(resource))
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := d.readFile(record)
+		if err != nil {
+			return nil, err
+		}
+
+		records[resource] = b
+	}
+
+	return records, nil
+}
+
+// RecordRef names a record of any collection.
+type RecordRef struct {
+	Collection string
+	Resource   string
+}
+
+// String returns the "collection/resource" key ReadMulti uses for the record.
+func (r RecordRef) String() string {
+	return r.Collection + "/" + r.Resource
 }
 
-func stat(path string)(fi os.FileInfo, err error) {
-	if fi, err = os.Stat(path); os.IsNotExist(err) {
-		fi, err = os.Stat(path + ".json")
+// ReadMulti reads records from any number of collections, holding the read
+// locks of all of them at once so the records are consistent with each other.
+// Each record goes into results under its RecordRef's String: decoded into
+// the value already there, which must then be a pointer, or as a generic
+// value if there's none. Missing records don't stop the others from being
+// read; they're listed in the error returned, which wraps ErrNotFound.
+func (d *Driver) ReadMulti(refs []RecordRef, results map[string]interface{}) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	collections := make([]string, 0, len(refs))
+
+	for _, ref := range refs {
+		if ref.Collection == "" {
+			return missingName("Missing collection - no place to read records!")
+		}
+
+		if ref.Resource == "" {
+			return missingName("Missing resource - unable to read record (no name)!")
+		}
+
+		if err := d.validateName(ref.Collection, ref.Resource); err != nil {
+			return err
+		}
+
+		collections = append(collections, ref.Collection)
+	}
+
+	unlock := d.rlockCollections(collections...)
+	defer unlock()
+
+	var missing []string
+
+	for _, ref := range refs {
+		b, err := d.readLocked(ref.Collection, d.canonical(ref.Resource))
+		if errors.Is(err, ErrNotFound) {
+			missing = append(missing, ref.String())
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to read record %s: %w", ref, err)
+		}
+
+		if v, ok := results[ref.String()]; ok && v != nil {
+			err = d.codec.Unmarshal(b, v)
+		} else {
+			var record interface{}
+			err = d.codec.Unmarshal(b, &record)
+			results[ref.String()] = record
+		}
+
+		if err != nil {
+			return fmt.Errorf("unable to decode record %s: %w", ref, err)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("unable to find records %s: %w", strings.Join(missing, ", "), ErrNotFound)
 	}
 
-	return fi, err
+	return nil
+}
+
+func (d *Driver) Read(collection, resource string, v interface{}) error {
+	return d.ReadContext(context.Background(), collection, resource, v)
 }
 
-type Address struct {
-	City string
-	State string
-	Country string
-	Pincode json.Number
+func (d *Driver) ReadContext(ctx context.Context, collection, resource string, v interface{}) (err error) {
+	ctx, end := d.instrument(ctx, "Read", collection, resource)
+	defer func() { end(err) }()
+
+	b, err := d.readBytes(ctx, collection, resource)
+	if err != nil {
+		return err
+	}
+
+	return d.codec.Unmarshal(b, v)
 }
 
-type User struct {
-	Name string
-	Age json.Number
-	Contact string
-	Company string
-	Address Address
+// ReadBytes returns a record exactly as Write marshalled it, trailing newline
+// included for text codecs unless NoTrailingNewline is set, without decoding
+// it.
+func (d *Driver) ReadBytes(collection, resource string) (b []byte, err error) {
+	ctx, end := d.instrument(context.Background(), "Read", collection, resource)
+	defer func() { end(err) }()
+
+	b, err = d.readBytes(ctx, collection, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cache may hold on to b, so the caller gets a copy of its own.
+	return bytes.Clone(b), nil
 }
 
-func main() {
-  dir := "./"
+// readBytes returns the marshalled record, from the cache if it's there. The
+// bytes must not be modified.
+func (d *Driver) readBytes(ctx context.Context, collection, resource string) ([]byte, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+  if collection == "" {
+		return nil, missingName("Missing collection - no place to read record!")
+	}
+
+	if resource == "" {
+		return nil, missingName("Missing resource - unable to read record (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return nil, err
+	}
 
-	db, err := New(dir, nil)
+	resource = d.canonical(resource)
 
+	release, err := d.acquireIO(ctx)
 	if err != nil {
-		// panic(err)
-		fmt.Println("Error:", err)
+		return nil, err
+	}
+	defer release()
+
+	mutex := d.getOrCreateMutex(collection)
+	if err := lockContext(ctx, mutex, true); err != nil {
+		return nil, err
 	}
+	defer mutex.RUnlock()
+
+	return d.readLocked(collection, resource)
+}
 
-	employees := []User {
-		{ "John", "23", "2378367837", "Google", Address{"Dhanbad", "Jharkhand", "India", "828122"} },
-		{ "Doe", "25", "2378367837", "Facebook", Address{"Ranchi", "Jharkhand", "India", "828133"} },
-		{ "Jane", "27", "2378367837", "Amazon", Address{"Jamshedpur", "Jharkhand", "India", "821645"} },
-		{ "Dane", "29", "2378367837", "Microsoft", Address{"Jamtara", "Jharkhand", "India", "287334"} },
-		{ "Pete", "31", "2378367837", "Apple", Address{"Bokaro", "Jharkhand", "India", "179232"} },
-		{ "Steve", "33", "2378367837", "Tesla", Address{"Bhuli", "Jharkhand", "India", "987632"} },
+// readLocked is readBytes for callers already holding the collection lock.
+func (d *Driver) readLocked(collection, resource string) ([]byte, error) {
+	key := cacheKey(collection, resource)
+
+	if b, ok := d.cache.get(key); ok {
+		d.counters.reads.Add(1)
+		return b, nil
 	}
 
-	for _, employee := range employees {
-		db.Write("users", employee.Name, User{
-			Name: employee.Name,
-			Age: employee.Age,
-			Contact: employee.Contact,
-			Company: employee.Company,
-			Address: employee.Address,
-		})
+	// With RecordLocks a writer only read-locks the collection, so without
+	// the record's stripe the bytes read here could be cached after the
+	// writer has replaced them and cleared the cache.
+	if d.cache != nil && d.recordLocks {
+		stripe := d.stripe(collection, resource)
+		stripe.Lock()
+		defer stripe.Unlock()
 	}
 
-	records, err := db.ReadAll("users")
+	record, _, err := d.recordFile(collection, resource)
+	if err != nil {
+		return nil, notFound(err)
+	}
 
+	b, err := d.readFile(record)
 	if err != nil {
-		fmt.Println("Error:", err)
+		return nil, err
 	}
 
-	fmt.Print(records)
+	if d.cache != nil {
+		meta, _ := d.readMeta(d.metaPath(collection, resource))
+		d.cache.add(key, b, meta.Expires)
+	}
 
-	allUsers := []User{}
+	return b, nil
+}
 
-  for _, f := range records {
-		employeeFound := User{}
+func (d *Driver) Update(collection, resource string, fn func(raw []byte) ([]byte, error)) (err error) {
+	ctx, end := d.instrument(context.Background(), "Update", collection, resource)
+	defer func() { end(err) }()
 
-		if err := json.Unmarshal([]byte(f), &employeeFound); err != nil {
-			fmt.Println("Error:", err)
-		}
+	if d.closed.Load() {
+		return ErrClosed
+	}
 
-		allUsers = append(allUsers, employeeFound)
+	if d.readOnly {
+		return ErrReadOnly
 	}
 
-	fmt.Println(allUsers)
+	if collection == "" {
+		return missingName("Missing collection - no place to update record!")
+	}
+
+	if resource == "" {
+		return missingName("Missing resource - unable to update record (no name)!")
+	}
 
-	// if err := db.Delete("users", "John"); err != nil {
-	// 	fmt.Println("Error:", err)
-	// }
+	if err := d.validateName(collection, resource); err != nil {
+		return err
+	}
+
+	resource = d.canonical(resource)
+
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	unlock, err := d.lockRecord(ctx, collection, resource)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	record, _, err := d.recordFile(collection, resource)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	b, err := d.readFile(record)
+	if err != nil {
+		return err
+	}
+
+	b, err = fn(b)
+	if err != nil {
+		return err
+	}
+
+	if err := d.writeRecord(collection, resource, b); err != nil {
+		return err
+	}
+
+	if err := d.updateMeta(collection, resource, (*recordMeta).bump); err != nil {
+		return err
+	}
+
+	pending.write(collection, resource, b)
+
+	return nil
+}
+
+// Upsert shallow-merges patch over the stored document, creating the record if
+// it does not exist yet. Only top-level keys are merged: a key present in patch
+// replaces the stored value wholesale (nested objects are not merged), and keys
+// absent from patch are left untouched.
+func (d *Driver) Upsert(collection, resource string, patch map[string]interface{}) (err error) {
+	ctx, end := d.instrument(context.Background(), "Upsert", collection, resource)
+	defer func() { end(err) }()
+
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to save record!")
+	}
+
+	if resource == "" {
+		return missingName("Missing resource - unable to save record (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return err
+	}
+
+	return d.upsert(ctx, collection, d.canonical(resource), func(doc map[string]interface{}) error {
+		for k, v := range patch {
+			doc[k] = v
+		}
+
+		return nil
+	})
+}
+
+// Increment adds delta to the numeric top-level field of a record, under the
+// record's lock, and returns the field's new value. A missing record or field
+// is created holding delta. A field holding anything but a number is an error.
+func (d *Driver) Increment(collection, resource, field string, delta float64) (value float64, err error) {
+	ctx, end := d.instrument(context.Background(), "Increment", collection, resource)
+	defer func() { end(err) }()
+
+	if d.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	if collection == "" {
+		return 0, missingName("Missing collection - no place to save record!")
+	}
+
+	if resource == "" {
+		return 0, missingName("Missing resource - unable to save record (no name)!")
+	}
+
+	if field == "" {
+		return 0, missingName("Missing field - unable to increment!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return 0, err
+	}
+
+	err = d.upsert(ctx, collection, d.canonical(resource), func(doc map[string]interface{}) error {
+		if v, ok := doc[field]; ok {
+			n, ok := toFloat(v)
+			if !ok {
+				return fmt.Errorf("unable to increment %s of %s: holds %T, not a number", field, resource, v)
+			}
+
+			value = n
+		}
+
+		value += delta
+		doc[field] = value
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return value, nil
+}
+
+// toFloat converts the numbers codecs decode into float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+// upsert rewrites a record, with the name given as stored, with what fn makes
+// of its document: the record's fields, or none if it doesn't exist yet, in
+// which case it's created.
+func (d *Driver) upsert(ctx context.Context, collection, resource string, fn func(doc map[string]interface{}) error) error {
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	unlock, err := d.lockRecord(ctx, collection, resource)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	doc := map[string]interface{}{}
+
+	record, _, err := d.recordFile(collection, resource)
+	created := os.IsNotExist(err)
+
+	switch {
+	case err == nil:
+		b, err := d.readFile(record)
+		if err != nil {
+			return err
+		}
+
+		if err := d.codec.Unmarshal(b, &doc); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	if err := fn(doc); err != nil {
+		return err
+	}
+
+	if err := d.fs.MkdirAll(dir, d.dirPerm); err != nil {
+		return err
+	}
+
+	b, err := d.marshal(collection, doc)
+	if err != nil {
+		return err
+	}
+
+	if err := d.writeRecord(collection, resource, b); err != nil {
+		return err
+	}
+
+	err = d.updateMeta(collection, resource, func(m *recordMeta) {
+		if created {
+			m.setTTL(d.ttl, d.clock.Now())
+		}
+		m.bump()
+	})
+	if err != nil {
+		return err
+	}
+
+	pending.write(collection, resource, b)
+
+	return nil
+}
+
+// WriteBatch writes several records of one collection as a unit. Every record
+// is marshalled and written to its ".tmp" file before any of them is renamed
+// into place, so a failure during that phase leaves the collection exactly as
+// it was. Renames happen in resource name order; if one of them fails, the
+// records renamed before it keep their new contents, the remaining ".tmp"
+// files are removed, and the error names the resource that failed. Only with
+// Options.WAL does the batch survive a crash during the renames, see WAL.
+func (d *Driver) WriteBatch(collection string, records map[string]interface{}) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to save records!")
+	}
+
+	records, err := d.canonicalRecords(records)
+	if err != nil {
+		return err
+	}
+
+	resources := make([]string, 0, len(records))
+
+	for resource := range records {
+		if resource == "" {
+			return missingName("Missing resource - unable to save record (no name)!")
+		}
+
+		if err := d.validateName(collection, resource); err != nil {
+			return err
+		}
+
+		resources = append(resources, resource)
+	}
+
+	sort.Strings(resources)
+
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	var written []string
+	marshalled := make(map[string][]byte, len(resources))
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	if err := d.fs.MkdirAll(dir, d.dirPerm); err != nil {
+		return err
+	}
+
+	var staged []string
+
+	d.indexMutex.Lock()
+	defer d.indexMutex.Unlock()
+
+	removeTmp := func() {
+		for _, path := range staged {
+			d.fs.Remove(path + ".tmp")
+		}
+	}
+
+	for _, resource := range resources {
+		raw, err := d.marshal(collection, records[resource])
+		if err != nil {
+			return fmt.Errorf("unable to marshal record %s: %w", resource, err)
+		}
+
+		if err := d.checkWritable(collection, resource, raw); err != nil {
+			return fmt.Errorf("unable to save record %s: %w", resource, err)
+		}
+
+		marshalled[resource] = raw
+	}
+
+	index, err := d.updateIndexes(collection, marshalled)
+	if err != nil {
+		return err
+	}
+
+	if index != nil {
+		// Index whatever got renamed into place, even if the batch fails.
+		defer func() {
+			if err := index(written...); err != nil {
+				d.log.Error("Unable to update indexes of %s: %s\n", collection, err)
+			}
+		}()
+	}
+
+	batch := walBatch{Collection: collection}
+
+	for _, resource := range resources {
+		b, err := d.encode(collection, marshalled[resource])
+		if err != nil {
+			removeTmp()
+			return fmt.Errorf("unable to encode record %s: %w", resource, err)
+		}
+
+		path := d.recordPath(collection, resource)
+		staged = append(staged, path)
+
+		if d.shardDepth > 0 {
+			if err := d.fs.MkdirAll(filepath.Dir(path), d.dirPerm); err != nil {
+				removeTmp()
+				return err
+			}
+		}
+
+		if d.wal || d.durability == DurabilitySync {
+			err = d.writeSynced(path+".tmp", b, d.filePerm)
+		} else {
+			err = d.fs.WriteFile(path+".tmp", b, d.filePerm)
+		}
+
+		if err != nil {
+			removeTmp()
+			return err
+		}
+
+		meta, err := d.readMeta(d.metaPath(collection, resource))
+		if err != nil && !os.IsNotExist(err) {
+			removeTmp()
+			return err
+		}
+
+		meta.setTTL(d.ttl, d.clock.Now())
+		meta.bump()
+
+		rel, err := filepath.Rel(d.dir, path)
+		if err != nil {
+			removeTmp()
+			return err
+		}
+
+		batch.Records = append(batch.Records, walRecord{Resource: resource, Path: filepath.ToSlash(rel), Meta: meta})
+	}
+
+	if d.wal {
+		d.walMutex.Lock()
+		defer d.walMutex.Unlock()
+
+		if err := d.logBatch(batch); err != nil {
+			removeTmp()
+			return err
+		}
+
+		// Only a crash leaves the log behind for New to replay; errors are
+		// reported to the caller instead.
+		defer func() {
+			if err := d.clearLog(); err != nil {
+				d.log.Error("Unable to clear %s: %s\n", walFile, err)
+			}
+		}()
+	}
+
+	for i, path := range staged {
+		if err := d.fs.Rename(path+".tmp", path); err != nil {
+			staged = staged[i:]
+			removeTmp()
+			return fmt.Errorf("batch partially applied - unable to save record %s: %w", resources[i], err)
+		}
+
+		d.removeStale(collection, resources[i])
+		d.cache.remove(cacheKey(collection, resources[i]))
+		d.counters.writes.Add(1)
+
+		if err := d.persisted(path); err != nil {
+			return err
+		}
+
+		if err := d.saveMeta(collection, resources[i], batch.Records[i].Meta); err != nil {
+			return err
+		}
+
+		written = append(written, resources[i])
+		pending.write(collection, resources[i], marshalled[resources[i]])
+	}
+
+	return nil
+}
+
+func (d *Driver) Exists(collection, resource string) (bool, error) {
+	if d.closed.Load() {
+		return false, ErrClosed
+	}
+
+	if collection == "" {
+		return false, missingName("Missing collection - no place to look for record!")
+	}
+
+	if resource == "" {
+		return false, missingName("Missing resource - unable to look for record (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return false, err
+	}
+
+	resource = d.canonical(resource)
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	if _, _, err := d.recordFile(collection, resource); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Stat returns the file information of a record, such as its size on disk and
+// when it was last written, without reading it.
+func (d *Driver) Stat(collection, resource string) (os.FileInfo, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	if collection == "" {
+		return nil, missingName("Missing collection - no place to look for record!")
+	}
+
+	if resource == "" {
+		return nil, missingName("Missing resource - unable to look for record (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return nil, err
+	}
+
+	resource = d.canonical(resource)
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	_, fi, err := d.recordFile(collection, resource)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return fi, nil
+}
+
+// ReadIfNewer reads a record into v only if it was written after since, going
+// by its file's modification time. Otherwise it reports false and leaves v
+// alone, without reading the record at all.
+func (d *Driver) ReadIfNewer(collection, resource string, since time.Time, v interface{}) (bool, error) {
+	if d.closed.Load() {
+		return false, ErrClosed
+	}
+
+	if collection == "" {
+		return false, missingName("Missing collection - no place to read record!")
+	}
+
+	if resource == "" {
+		return false, missingName("Missing resource - unable to read record (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return false, err
+	}
+
+	resource = d.canonical(resource)
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	record, fi, err := d.recordFile(collection, resource)
+	if err != nil {
+		return false, notFound(err)
+	}
+
+	if !fi.ModTime().After(since) {
+		return false, nil
+	}
+
+	b, err := d.readFile(record)
+	if err != nil {
+		return false, err
+	}
+
+	return true, d.codec.Unmarshal(b, v)
+}
+
+func (d *Driver) ReadAll(collection string)([]string, error) {
+	return d.ReadAllContext(context.Background(), collection)
+}
+
+// ReadAllContext is ReadAll that gives up, returning ctx.Err(), once ctx is
+// done. Cancellation is checked before each file is read.
+func (d *Driver) ReadAllContext(ctx context.Context, collection string) (records []string, err error) {
+	ctx, end := d.instrument(ctx, "ReadAll", collection, "")
+	defer func() { end(err) }()
+
+	err = d.readAll(ctx, collection, time.Time{}, func(resource string, b []byte) {
+		records = append(records, string(b))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// ReadAllWithKeys is ReadAll returning the records keyed by their names, for
+// records that don't hold their own name.
+func (d *Driver) ReadAllWithKeys(collection string) (map[string]string, error) {
+	return d.ReadAllSince(collection, time.Time{})
+}
+
+// ReadAllSince is ReadAllWithKeys for the records written after since, going
+// by their files' modification times, for syncing a copy incrementally. A zero
+// since returns them all. Modification times come from the filesystem's
+// clock, not the Driver's, and change whenever a file is touched, so clock
+// skew between machines or tools touching files throw it off.
+func (d *Driver) ReadAllSince(collection string, since time.Time) (records map[string]string, err error) {
+	ctx, end := d.instrument(context.Background(), "ReadAll", collection, "")
+	defer func() { end(err) }()
+
+	records = make(map[string]string)
+
+	err = d.readAll(ctx, collection, since, func(resource string, b []byte) {
+		records[resource] = string(b)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// readAll calls add with the name and contents of every record of the
+// collection written after since, in name order, holding the collection lock
+// throughout.
+func (d *Driver) readAll(ctx context.Context, collection string, since time.Time, add func(resource string, b []byte)) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+  if collection == "" {
+		return missingName("Missing collection - no place to read records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return err
+	}
+
+	release, err := d.acquireIO(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	mutex := d.getOrCreateMutex(collection)
+	if err := lockContext(ctx, mutex, true); err != nil {
+		return err
+	}
+	defer mutex.RUnlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	if _, err := d.stat(collection, dir); err != nil {
+		return notFound(err)
+	}
+
+	files, err := d.listRecords(collection)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if !since.IsZero() {
+			fi, err := d.fs.Stat(filepath.Join(dir, file))
+			if err != nil {
+				return err
+			}
+
+			if !fi.ModTime().After(since) {
+				continue
+			}
+		}
+
+		b, err := d.readFile(filepath.Join(dir, file))
+
+		if err != nil {
+			return err
+		}
+
+		add(d.recordName(collection, file), b)
+	}
+
+	return nil
+}
+
+// ReadPage returns at most limit records starting at offset. Records are
+// ordered by file name, so consecutive pages are stable across calls.
+func (d *Driver) ReadPage(collection string, offset, limit int) ([]string, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	if collection == "" {
+		return nil, missingName("Missing collection - no place to read records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid page limit %d - must be greater than zero", limit)
+	}
+
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid page offset %d - must not be negative", offset)
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	if _, err := d.stat(collection, dir); err != nil {
+		return nil, notFound(err)
+	}
+
+	files, err := d.listRecords(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []string{}
+
+	for _, file := range files {
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		b, err := d.readFile(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, string(b))
+
+		if len(records) == limit {
+			break
+		}
+	}
+
+	return records, nil
+}
+
+// Each calls fn with every record in the collection, one file at a time, and
+// stops at the first error fn returns. The collection lock is held while the
+// directory is listed and each file is read, but never while fn runs, so fn may
+// take its time without blocking writers. Records deleted mid-iteration are
+// skipped.
+func (d *Driver) Each(collection string, fn func(resource string, raw []byte) error) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to read records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return err
+	}
+
+	dir := filepath.Join(d.dir, collection)
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+
+	if _, err := d.stat(collection, dir); err != nil {
+		mutex.RUnlock()
+		return notFound(err)
+	}
+
+	files, err := d.listRecords(collection)
+	mutex.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		mutex.RLock()
+		b, err := d.readFile(filepath.Join(dir, file))
+		mutex.RUnlock()
+
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := fn(d.recordName(collection, file), b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Query returns the records for which pred reports true. pred gets each
+// record's raw bytes so it can decode whatever shape it needs; the first error
+// it returns aborts the scan.
+func (d *Driver) Query(collection string, pred func(raw []byte) (bool, error)) ([]string, error) {
+	var records []string
+
+	err := d.Each(collection, func(resource string, raw []byte) error {
+		ok, err := pred(raw)
+		if err != nil {
+			return fmt.Errorf("query failed on record %s: %w", resource, err)
+		}
+
+		if ok {
+			records = append(records, string(raw))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (d *Driver) ReadAllInto(collection string, dest interface{}) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to read records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return err
+	}
+
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("destination must be a non-nil pointer to a slice, got %T", dest)
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	if _, err := d.stat(collection, dir); err != nil {
+		return notFound(err)
+	}
+
+	files, err := d.listRecords(collection)
+	if err != nil {
+		return err
+	}
+
+	slice := rv.Elem()
+
+	for _, file := range files {
+		b, err := d.readFile(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+
+		elem := reflect.New(slice.Type().Elem())
+
+		if err := d.codec.Unmarshal(b, elem.Interface()); err != nil {
+			return err
+		}
+
+		slice = reflect.Append(slice, elem.Elem())
+	}
+
+	rv.Elem().Set(slice)
+
+	return nil
+}
+
+func (d *Driver) Count(collection string) (int, error) {
+	if d.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	if collection == "" {
+		return 0, missingName("Missing collection - no place to count records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return 0, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	if _, err := d.stat(collection, dir); err != nil {
+		return 0, notFound(err)
+	}
+
+	files, err := d.listRecords(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(files), nil
+}
+
+// Keys returns the names of the live records of a collection, sorted.
+func (d *Driver) Keys(collection string) ([]string, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	if collection == "" {
+		return nil, missingName("Missing collection - no place to list records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	files, err := d.listRecords(collection)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	keys := make([]string, len(files))
+
+	for i, file := range files {
+		keys[i] = d.recordName(collection, file)
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// Rename gives a record a new name within its collection. The record file is
+// renamed in place, which is atomic on a single filesystem. Hooks see a delete
+// of the old name followed by a write of the new one.
+func (d *Driver) Rename(collection, oldResource, newResource string) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to rename record!")
+	}
+
+	if oldResource == "" || newResource == "" {
+		return missingName("Missing resource - unable to rename record (no name)!")
+	}
+
+	if err := d.validateName(collection, oldResource, newResource); err != nil {
+		return err
+	}
+
+	oldResource, newResource = d.canonical(oldResource), d.canonical(newResource)
+
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	src, fi, err := d.recordFile(collection, oldResource)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	if oldResource == newResource {
+		return nil
+	}
+
+	if d.reserved(collection, newResource) {
+		return fmt.Errorf("%w %q - reserved for the collection schema", ErrInvalidName, newResource)
+	}
+
+	dst, _, err := d.recordFile(collection, newResource)
+	switch {
+	case err == nil && !d.allowOverwrite:
+		return fmt.Errorf("unable to rename %s to %s: %w", oldResource, newResource, ErrExists)
+	case err == nil:
+		if err := d.fs.Remove(dst); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	// Read for the hooks before anything is moved.
+	raw, err := d.readFile(src)
+	if err != nil {
+		return err
+	}
+
+	dst = filepath.Join(d.shard(filepath.Join(d.dir, collection), newResource), newResource+strings.TrimPrefix(fi.Name(), oldResource))
+
+	if err := d.fs.MkdirAll(filepath.Dir(dst), d.dirPerm); err != nil {
+		return err
+	}
+
+	d.cache.remove(cacheKey(collection, oldResource))
+	d.cache.remove(cacheKey(collection, newResource))
+
+	if err := d.fs.Rename(src, dst); err != nil {
+		return err
+	}
+
+	err = d.fs.Rename(d.metaPath(collection, oldResource), d.metaPath(collection, newResource))
+	if os.IsNotExist(err) {
+		err = d.fs.Remove(d.metaPath(collection, newResource))
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	pending.delete(collection, oldResource)
+	pending.write(collection, newResource, raw)
+
+	return d.renameIndexed(collection, oldResource, newResource)
+}
+
+func (d *Driver) Collections() ([]string, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	files, err := d.fs.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	collections := []string{}
+
+	for _, file := range files {
+		if !file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		collections = append(collections, file.Name())
+	}
+
+	return collections, nil
+}
+
+func (d *Driver) Delete(collection, resource string) error {
+	return d.DeleteContext(context.Background(), collection, resource)
+}
+
+// DeleteContext is Delete that gives up, returning ctx.Err(), if ctx is done
+// before the lock is acquired.
+func (d *Driver) DeleteContext(ctx context.Context, collection, resource string) (err error) {
+	ctx, end := d.instrument(ctx, "Delete", collection, resource)
+	defer func() { end(err) }()
+
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	// Without a collection the path below is the database directory itself.
+	if collection == "" {
+		return missingName("Missing collection - unable to delete (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return err
+	}
+
+	resource = d.canonical(resource)
+
+	path := filepath.Join(d.dir, collection)
+	if resource != "" {
+		path = filepath.Join(d.shard(path, resource), resource)
+	}
+
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	// Without a resource this deletes the whole collection directory, which
+	// needs the collection to itself.
+	if resource == "" {
+		mutex := d.getOrCreateMutex(collection)
+		if err := lockContext(ctx, mutex, false); err != nil {
+			return err
+		}
+		defer mutex.Unlock()
+	} else {
+		unlock, err := d.lockRecord(ctx, collection, resource)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	switch fi, err := d.stat(collection, path); {
+		case errors.Is(err, ErrNotFound):
+			return fmt.Errorf("unable to find file or directory named: %s: %w", path, ErrNotFound)
+		case err != nil:
+			return err
+		case fi.Mode().IsDir():
+			d.cache.removeCollection(collection)
+			d.schemas.Delete(collection)
+			d.forgetIndexes(collection)
+			return d.fs.RemoveAll(path)
+		case fi.Mode().IsRegular():
+			record := filepath.Join(filepath.Dir(path), fi.Name())
+			d.cache.remove(cacheKey(collection, resource))
+
+			if d.softDelete {
+				if err := d.trash(collection, resource, record); err != nil {
+					return err
+				}
+			} else {
+				if err := d.fs.Remove(d.metaPath(collection, resource)); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+
+				if err := d.fs.RemoveAll(record); err != nil {
+					return err
+				}
+			}
+
+			pending.delete(collection, resource)
+			d.counters.deletes.Add(1)
+
+			if err := d.unindex(collection, resource); err != nil {
+				return err
+			}
+	}
+
+	return nil
+}
+
+// DeleteAll removes every record of a collection, expired or not, and returns
+// how many there were. The collection itself stays, along with its schema and
+// indexes.
+func (d *Driver) DeleteAll(collection string) (int, error) {
+	if d.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	if collection == "" {
+		return 0, missingName("Missing collection - no place to delete records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return 0, err
+	}
+
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	var deleted []string
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	files, err := d.collectionFiles(dir)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	d.cache.removeCollection(collection)
+
+	// Drop whatever was removed from the indexes, even if deleting fails.
+	defer func() {
+		if len(deleted) > 0 {
+			if err := d.unindex(collection, deleted...); err != nil {
+				d.log.Error("Unable to update indexes of %s: %s\n", collection, err)
+			}
+		}
+	}()
+
+	for _, file := range files {
+		if !d.isRecordName(collection, filepath.Base(file)) {
+			continue
+		}
+
+		resource := d.recordName(collection, file)
+
+		if err := d.fs.Remove(filepath.Join(dir, file)); err != nil {
+			return len(deleted), err
+		}
+
+		if err := d.fs.Remove(d.metaPath(collection, resource)); err != nil && !os.IsNotExist(err) {
+			return len(deleted), err
+		}
+
+		deleted = append(deleted, resource)
+		pending.delete(collection, resource)
+		d.counters.deletes.Add(1)
+	}
+
+	return len(deleted), nil
+}
+
+// DeleteWhere removes the records of a collection for which pred reports true
+// and returns how many it removed. The collection is locked for the whole
+// scan, so no record can change between pred accepting it and its removal.
+// The first error pred returns stops the scan, leaving the records removed so
+// far deleted.
+func (d *Driver) DeleteWhere(collection string, pred func(raw []byte) (bool, error)) (int, error) {
+	if d.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	if collection == "" {
+		return 0, missingName("Missing collection - no place to delete records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return 0, err
+	}
+
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	var deleted []string
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	files, err := d.listRecords(collection)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	defer func() {
+		if len(deleted) > 0 {
+			if err := d.unindex(collection, deleted...); err != nil {
+				d.log.Error("Unable to update indexes of %s: %s\n", collection, err)
+			}
+		}
+	}()
+
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		resource := d.recordName(collection, file)
+
+		b, err := d.readFile(path)
+		if err != nil {
+			return len(deleted), err
+		}
+
+		ok, err := pred(b)
+		if err != nil {
+			return len(deleted), fmt.Errorf("delete failed on record %s: %w", resource, err)
+		}
+
+		if !ok {
+			continue
+		}
+
+		d.cache.remove(cacheKey(collection, resource))
+
+		if d.softDelete {
+			err = d.trash(collection, resource, path)
+		} else {
+			err = d.fs.Remove(path)
+			if err == nil {
+				err = d.fs.Remove(d.metaPath(collection, resource))
+			}
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			return len(deleted), err
+		}
+
+		deleted = append(deleted, resource)
+		pending.delete(collection, resource)
+		d.counters.deletes.Add(1)
+	}
+
+	return len(deleted), nil
+}
+
+// DeleteCollection removes a collection with all of its records and forgets
+// its mutex, so processes that churn through collections don't leak them.
+func (d *Driver) DeleteCollection(collection string) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - unable to delete collection (no name)!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	fi, err := d.fs.Stat(dir)
+	if err != nil || !fi.IsDir() {
+		return fmt.Errorf("unable to find collection named: %s: %w", collection, ErrNotFound)
+	}
+
+	d.cache.removeCollection(collection)
+	d.schemas.Delete(collection)
+	d.forgetIndexes(collection)
+
+	if err := d.fs.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	delete(d.mutexes, collection)
+	d.mutex.Unlock()
+
+	return nil
+}
+
+// Dir returns the directory the database lives in, cleaned.
+func (d *Driver) Dir() string {
+	return d.dir
+}
+
+// Local reports whether the database is kept on the operating system's file
+// system, the default FileSystem.
+func (d *Driver) Local() bool {
+	_, ok := d.fs.(osFS)
+	return ok
+}
+
+// Logger returns the Logger the Driver reports to.
+func (d *Driver) Logger() Logger {
+	return d.log
+}
+
+// RecordName returns the name of the record stored in a file of a collection,
+// given the file's base name, and false if the file doesn't hold a record.
+func (d *Driver) RecordName(collection, file string) (string, bool) {
+	if !d.isRecordName(collection, file) {
+		return "", false
+	}
+
+	return d.recordName(collection, file), true
+}
+
+// ResourcePath returns the path Write stores a record at, taking the
+// extension, compression and sharding into account. The names aren't
+// validated, and nothing needs to exist there.
+func (d *Driver) ResourcePath(collection, resource string) string {
+	return d.recordPath(collection, d.canonical(resource))
+}
+
+// Close marks the driver as closed and releases its collection mutexes, after
+// flushing writes still pending under DurabilityBatched. Any operation started
+// afterwards fails with ErrClosed.
+func (d *Driver) Close() error {
+	if !d.closed.CompareAndSwap(false, true) {
+		return ErrClosed
+	}
+
+	d.mutex.Lock()
+	d.mutexes = make(map[string]*sync.RWMutex)
+	d.mutex.Unlock()
+
+	if d.syncer != nil {
+		return d.syncer.stop()
+	}
+
+	return nil
+}
+
+func (d *Driver) getOrCreateMutex(collection string) *sync.RWMutex {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+  m, ok := d.mutexes[collection]
+
+	if !ok {
+		m = &sync.RWMutex{}
+		d.mutexes[collection] = m
+	}
+
+	return m
+}
+
+// notFound makes a missing-file error match ErrNotFound, keeping the
+// underlying error for detail. Other errors, and those already matching it, are
+// returned unchanged.
+func notFound(err error) error {
+	if errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	return err
+}
+
+// validateName rejects collection and resource names that would resolve to a
+// path outside of their collection, such as "../evil", "a/b" or "/etc/passwd",
+// those starting with a dot, which are kept for the database's own files such
+// as ".trash", and those longer than MaxNameLength. The first name, a
+// collection's unless it's the only one, must not be empty, since an empty
+// collection name would resolve to the database directory itself. Empty names
+// after it are left for the callers to report.
+func (d *Driver) validateName(name string, names ...string) error {
+	if name == "" {
+		return missingName("Missing collection - no name given!")
+	}
+
+	for _, name := range append([]string{name}, names...) {
+		if name == "" {
+			continue
+		}
+
+		if name == "." || name == ".." || strings.ContainsAny(name, `/\`) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+			return fmt.Errorf("%w %q - must not be a path or contain path separators", ErrInvalidName, name)
+		}
+
+		if strings.HasPrefix(name, ".") {
+			return fmt.Errorf("%w %q - names starting with a dot are reserved", ErrInvalidName, name)
+		}
+
+		if len(name) > d.maxNameLength {
+			return fmt.Errorf("%w: %q... is %d bytes, over the limit of %d", ErrNameTooLong, name[:min(len(name), 16)], len(name), d.maxNameLength)
+		}
+	}
+
+	return nil
+}
+
+// canonical returns the name a resource is stored under: lower-cased with
+// CaseInsensitiveKeys, as is otherwise.
+func (d *Driver) canonical(resource string) string {
+	if d.caseInsensitive {
+		return strings.ToLower(resource)
+	}
+
+	return resource
+}
+
+// canonicalRecords returns records keyed by their canonical names, failing if
+// two of them share one.
+func (d *Driver) canonicalRecords(records map[string]interface{}) (map[string]interface{}, error) {
+	if !d.caseInsensitive {
+		return records, nil
+	}
+
+	canonical := make(map[string]interface{}, len(records))
+
+	for resource, v := range records {
+		name := d.canonical(resource)
+
+		if _, ok := canonical[name]; ok {
+			return nil, fmt.Errorf("%w %q - another record has the same name, ignoring case", ErrInvalidName, resource)
+		}
+
+		canonical[name] = v
+	}
+
+	return canonical, nil
+}
+
+// lockRecord takes the locks needed to modify a single record and returns the
+// func releasing them. With RecordLocks the collection is only read-locked,
+// which still excludes collection-wide operations, and the record is guarded
+// by one of a fixed set of striped mutexes so the lock table never grows.
+func (d *Driver) lockRecord(ctx context.Context, collection, resource string) (func(), error) {
+	mutex := d.getOrCreateMutex(collection)
+
+	if !d.recordLocks {
+		if err := lockContext(ctx, mutex, false); err != nil {
+			return nil, err
+		}
+		return mutex.Unlock, nil
+	}
+
+	if err := lockContext(ctx, mutex, true); err != nil {
+		return nil, err
+	}
+
+	stripe := d.stripe(collection, resource)
+	stripe.Lock()
+
+	return func() {
+		stripe.Unlock()
+		mutex.RUnlock()
+	}, nil
+}
+
+// stripe returns the mutex guarding the record with RecordLocks.
+func (d *Driver) stripe(collection, resource string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(cacheKey(collection, resource)))
+
+	return &d.stripes[h.Sum32()%uint32(len(d.stripes))]
+}
+
+// lockContext locks mu, or read-locks it when read is set, unless ctx is done
+// first. When it gives up, the lock is released again as soon as the pending
+// acquisition completes.
+func lockContext(ctx context.Context, mu *sync.RWMutex, read bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	lock, unlock := mu.Lock, mu.Unlock
+	if read {
+		lock, unlock = mu.RLock, mu.RUnlock
+	}
+
+	if ctx.Done() == nil {
+		lock()
+		return nil
+	}
+
+	acquired := make(chan struct{})
+
+	go func() {
+		lock()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-acquired
+			unlock()
+		}()
+		return ctx.Err()
+	}
+}
+
+func (d *Driver) marshal(collection string, v interface{}) ([]byte, error) {
+	codec := d.codecFor(collection)
+
+	b, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only text formats end with a newline; binary ones, such as gob, are
+	// stored as they are.
+	switch codec.(type) {
+	case JSONCodec, YAMLCodec:
+	default:
+		return b, nil
+	}
+
+	if d.noTrailingNewline || len(b) > 0 && b[len(b)-1] == '\n' {
+		return b, nil
+	}
+
+	return append(b, byte('\n')), nil
+}
+
+// recordPath returns the path Write stores a record at.
+func (d *Driver) recordPath(collection, resource string) string {
+	path := filepath.Join(d.shard(filepath.Join(d.dir, collection), resource), resource+d.extFor(collection))
+
+	if d.compressed(collection) {
+		path += ".gz"
+	}
+
+	return path
+}
+
+// recordFile locates the file currently holding a record, which may or may not
+// be compressed regardless of the Compress option.
+func (d *Driver) recordFile(collection, resource string) (string, os.FileInfo, error) {
+	path := d.recordPath(collection, resource)
+
+	if d.expired(filepath.Join(d.dir, collection), resource) {
+		return path, nil, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+	}
+
+	fi, err := d.fs.Stat(path)
+	if os.IsNotExist(err) {
+		alt := strings.TrimSuffix(path, ".gz")
+		if alt == path {
+			alt += ".gz"
+		}
+
+		if fi, err := d.fs.Stat(alt); err == nil {
+			return alt, fi, nil
+		}
+	}
+
+	return path, fi, err
+}
+
+// writeRecord stores the marshalled record b at its final path and drops any
+// copy left behind in the other (compressed or uncompressed) format.
+func (d *Driver) writeRecord(collection, resource string, b []byte) error {
+	if err := d.checkWritable(collection, resource, b); err != nil {
+		return err
+	}
+
+	// Collections without indexes don't hold on to the index lock, so they
+	// aren't serialized with every other write.
+	d.indexMutex.Lock()
+
+	index, err := d.updateIndexes(collection, map[string][]byte{resource: b})
+	if index == nil {
+		d.indexMutex.Unlock()
+	} else {
+		defer d.indexMutex.Unlock()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	d.cache.remove(cacheKey(collection, resource))
+
+	b, err = d.encode(collection, b)
+	if err != nil {
+		return err
+	}
+
+	path := d.recordPath(collection, resource)
+
+	if d.shardDepth > 0 {
+		if err := d.fs.MkdirAll(filepath.Dir(path), d.dirPerm); err != nil {
+			return err
+		}
+	}
+
+	if err := d.writeFile(path, b); err != nil {
+		return err
+	}
+
+	d.removeStale(collection, resource)
+	d.counters.writes.Add(1)
+
+	if index != nil {
+		return index(resource)
+	}
+
+	return nil
+}
+
+func (d *Driver) removeStale(collection, resource string) {
+	stale := filepath.Join(d.shard(filepath.Join(d.dir, collection), resource), resource+d.extFor(collection))
+
+	if !d.compressed(collection) {
+		stale += ".gz"
+	}
+
+	d.fs.Remove(stale)
+}
+
+// encode turns a marshalled record into the bytes stored on disk, compressing
+// and encrypting it as configured.
+func (d *Driver) encode(collection string, b []byte) ([]byte, error) {
+	if d.compressed(collection) {
+		var buf bytes.Buffer
+
+		zw := gzip.NewWriter(&buf)
+
+		if _, err := zw.Write(b); err != nil {
+			return nil, err
+		}
+
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+		b = buf.Bytes()
+	}
+
+	if d.aead != nil {
+		return encrypt(d.aead, b)
+	}
+
+	return b, nil
+}
+
+// readFile reads a record file, decrypting and decompressing it as needed.
+func (d *Driver) readFile(path string) ([]byte, error) {
+	b, err := d.readRawFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasSuffix(path, ".gz") {
+		return b, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return io.ReadAll(zr)
+}
+
+// readRawFile reads a file and decrypts it, without gunzipping it whatever its
+// name.
+func (d *Driver) readRawFile(path string) ([]byte, error) {
+	var b []byte
+
+	err := d.retry(func() (err error) {
+		b, err = d.fs.ReadFile(path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	d.counters.reads.Add(1)
+
+	if d.aead != nil {
+		if b, err = decrypt(d.aead, b); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// listRecords returns the paths, relative to the collection's directory, of
+// its live records, sorted by name. Expired records are left out.
+func (d *Driver) listRecords(collection string) ([]string, error) {
+	dir := filepath.Join(d.dir, collection)
+
+	files, err := d.collectionFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	metas := map[string]bool{}
+
+	for _, file := range files {
+		if strings.HasSuffix(file, metaExt) {
+			metas[strings.TrimSuffix(filepath.Base(file), metaExt)] = true
+		}
+	}
+
+	var records []string
+
+	for _, file := range files {
+		if !d.isRecordName(collection, filepath.Base(file)) {
+			continue
+		}
+
+		if resource := d.recordName(collection, file); metas[resource] && d.expired(dir, resource) {
+			continue
+		}
+
+		records = append(records, file)
+	}
+
+	return records, nil
+}
+
+// isRecordName reports whether a file name is that of a stored record, as
+// opposed to metadata or an in-flight ".tmp" file.
+func (d *Driver) isRecordName(collection, name string) bool {
+	if name == schemaFile {
+		return false
+	}
+
+	ext := d.extFor(collection)
+
+	return strings.HasSuffix(name, ext) || strings.HasSuffix(name, ext+".gz")
+}
+
+// reserved reports whether a record named resource would clash with the
+// collection's schema file.
+func (d *Driver) reserved(collection, resource string) bool {
+	return resource+d.extFor(collection) == schemaFile
+}
+
+// checkWritable reports why the marshalled record b may not be saved, if
+// there's a reason.
+func (d *Driver) checkWritable(collection, resource string, b []byte) error {
+	if d.reserved(collection, resource) {
+		return fmt.Errorf("%w %q - reserved for the collection schema", ErrInvalidName, resource)
+	}
+
+	if limit := d.recordLimit(collection); limit > 0 && len(b) > limit {
+		return fmt.Errorf("%w: %s is %d bytes, the limit is %d", ErrRecordTooLarge, resource, len(b), limit)
+	}
+
+	return d.validate(collection, b)
+}
+
+// recordName returns the resource name stored in a record file.
+func (d *Driver) recordName(collection, file string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), ".gz"), d.extFor(collection))
+}
+
+// writeFile writes b next to path first and renames it into place, so readers
+// never observe a partially written record. It's then flushed as the
+// Durability option asks.
+func (d *Driver) writeFile(path string, b []byte) error {
+	tmpPath := path + ".tmp"
+
+	write := d.fs.WriteFile
+	if d.durability == DurabilitySync {
+		write = d.writeSynced
+	}
+
+	err := d.retry(func() error {
+		return write(tmpPath, b, d.filePerm)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = d.retry(func() error {
+		return d.fs.Rename(tmpPath, path)
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.persisted(path)
+}
+
+// stat returns the file information of path, which names either a directory
+// or a record of the collection without its extension. The record's own names
+// are tried first, so a failure other than the file not existing, such as a
+// permission error, is reported for the file actually holding the record.
+// When nothing exists at any of the names, the error wraps ErrNotFound.
+func (d *Driver) stat(collection, path string) (os.FileInfo, error) {
+	var failure error
+
+	ext := d.extFor(collection)
+
+	for _, name := range []string{path + ext, path + ext + ".gz", path} {
+		fi, err := d.fs.Stat(name)
+		if err == nil {
+			return fi, nil
+		}
+
+		if !os.IsNotExist(err) && failure == nil {
+			failure = err
+		}
+	}
+
+	if failure != nil {
+		return nil, failure
+	}
 
-	// if err := db.Delete("users", ""); err != nil {
-	// 	fmt.Println("Error:", err)
-	// }
+	return nil, notFound(&os.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist})
 }
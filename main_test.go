@@ -0,0 +1,1456 @@
+package minidb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// quietLogger discards everything logged, keeping test output readable.
+type quietLogger struct{}
+
+func (quietLogger) Fatal(string, ...interface{}) {}
+func (quietLogger) Error(string, ...interface{}) {}
+func (quietLogger) Warn(string, ...interface{})  {}
+func (quietLogger) Info(string, ...interface{})  {}
+func (quietLogger) Debug(string, ...interface{}) {}
+func (quietLogger) Trace(string, ...interface{}) {}
+
+// newTestDriver opens a Driver on a fresh temporary directory.
+func newTestDriver(t testing.TB, opts *Options) *Driver {
+	t.Helper()
+
+	return newTestDriverAt(t, t.TempDir(), opts)
+}
+
+// newTestDriverAt opens a Driver on dir.
+func newTestDriverAt(t testing.TB, dir string, opts *Options) *Driver {
+	t.Helper()
+
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = quietLogger{}
+	}
+
+	d, err := New(dir, opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	t.Cleanup(func() { d.Close() })
+
+	return d
+}
+
+type user struct {
+	Name    string
+	Age     int
+	Company string
+	State   string
+}
+
+func TestUpsert(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	tests := []struct {
+		patch map[string]interface{}
+		want  map[string]interface{}
+	}{
+		{map[string]interface{}{"a": 1.0}, map[string]interface{}{"a": 1.0}},
+		{map[string]interface{}{"b": map[string]interface{}{"c": 2.0}}, map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"c": 2.0}}},
+		{map[string]interface{}{"b": map[string]interface{}{"d": 3.0}}, map[string]interface{}{"a": 1.0, "b": map[string]interface{}{"d": 3.0}}},
+	}
+
+	for _, tt := range tests {
+		if err := d.Upsert("docs", "x", tt.patch); err != nil {
+			t.Fatal(err)
+		}
+
+		var got map[string]interface{}
+		if err := d.Read("docs", "x", &got); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("after Upsert(%v) = %v, %v; want %v", tt.patch, got, err, tt.want)
+		}
+	}
+
+	if err := d.Write("docs", "list", []int{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Upsert("docs", "list", map[string]interface{}{"a": 1}); err == nil {
+		t.Error("Upsert over an array succeeded")
+	}
+}
+
+func TestReadAllInto(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for i := 1; i <= 4; i++ {
+		if err := d.Write("users", fmt.Sprint(i), user{Name: fmt.Sprint(i), Age: i * 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var all []user
+	if err := d.ReadAllInto("users", &all); err != nil || len(all) != 4 || all[3].Age != 40 {
+		t.Errorf("ReadAllInto = %+v, %v", all, err)
+	}
+
+	var wrong []string
+	if err := d.ReadAllInto("users", &wrong); err == nil {
+		t.Error("ReadAllInto a slice of the wrong type succeeded")
+	}
+
+	if err := d.ReadAllInto("users", all); err == nil {
+		t.Error("ReadAllInto a slice, not a pointer to one, succeeded")
+	}
+
+	if err := d.ReadAllInto("missing", &all); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadAllInto(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestReadPage(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for i := 0; i < 5; i++ {
+		if err := d.Write("users", fmt.Sprint(i), user{Name: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		offset, limit int
+		want          []string
+	}{
+		{0, 2, []string{"0", "1"}},
+		{2, 2, []string{"2", "3"}},
+		{4, 2, []string{"4"}},
+		{5, 2, nil},
+	}
+
+	for _, tt := range tests {
+		page, err := d.ReadPage("users", tt.offset, tt.limit)
+		if got := names(t, page); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ReadPage(%d, %d) = %v, %v; want %v", tt.offset, tt.limit, got, err, tt.want)
+		}
+	}
+
+	for _, bad := range [][2]int{{-1, 2}, {0, 0}} {
+		if _, err := d.ReadPage("users", bad[0], bad[1]); err == nil {
+			t.Errorf("ReadPage(%d, %d) succeeded", bad[0], bad[1])
+		}
+	}
+}
+
+func TestDeleteCollection(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("users", "john", user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DeleteCollection("users"); err != nil {
+		t.Fatal(err)
+	}
+
+	if collections, _ := d.Collections(); len(collections) != 0 {
+		t.Errorf("Collections = %v after DeleteCollection", collections)
+	}
+
+	if _, ok := d.mutexes["users"]; ok {
+		t.Error("the mutex of the deleted collection is kept")
+	}
+
+	if err := d.DeleteCollection("users"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second DeleteCollection = %v, want ErrNotFound", err)
+	}
+
+	// The collection can be used again.
+	if err := d.Write("users", "jane", user{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Delete("users", "john"); err != nil {
+		t.Fatalf("Delete = %v", err)
+	}
+
+	if exists, err := d.Exists("users", "john"); err != nil || exists {
+		t.Errorf("Exists after Delete = %v, %v", exists, err)
+	}
+
+	if err := d.Delete("users", "john"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete = %v, want ErrNotFound", err)
+	}
+
+	// A metadata file that can't be removed fails the delete, leaving the
+	// record in place.
+	if err := d.Write("users", "jane", user{Name: "jane"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(d.metaPath("users", "jane"), "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Delete("users", "jane"); err == nil {
+		t.Error("Delete succeeded without removing the metadata")
+	}
+
+	if exists, _ := d.Exists("users", "jane"); !exists {
+		t.Error("failed Delete removed the record")
+	}
+}
+
+func TestDeleteRequiresCollection(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("orders", "1", map[string]int{"total": 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		collection string
+		resource   string
+	}{
+		{"both empty", "", ""},
+		{"empty collection", "", "john"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := d.Delete(tt.collection, tt.resource); err == nil {
+				t.Fatalf("Delete(%q, %q) succeeded", tt.collection, tt.resource)
+			}
+		})
+	}
+
+	for _, collection := range []string{"users", "orders"} {
+		if n, err := d.Count(collection); err != nil || n != 1 {
+			t.Errorf("Count(%q) = %d, %v after the deletes, want 1", collection, n, err)
+		}
+	}
+}
+
+func TestReadAllSkipsOtherFiles(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for _, name := range []string{"a", "b"} {
+		if err := d.Write("users", name, user{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"c.json.tmp", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(d.dir, "users", name), []byte("{"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(d.dir, "users", "sub.json"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := d.ReadAll("users")
+	if err != nil || len(records) != 2 {
+		t.Fatalf("ReadAll = %d records, %v; want 2", len(records), err)
+	}
+
+	withKeys, err := d.ReadAllWithKeys("users")
+	if err != nil || len(withKeys) != 2 || withKeys["a"] == "" || withKeys["b"] == "" {
+		t.Errorf("ReadAllWithKeys = %v, %v", withKeys, err)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	tests := []struct {
+		name    string
+		names   []string
+		invalid bool
+	}{
+		{"users", nil, false},
+		{"users", []string{"john"}, false},
+		{"users", []string{""}, false},
+		{"", nil, true},
+		{"", []string{"john"}, true},
+		{".", nil, true},
+		{"..", nil, true},
+		{"a/b", nil, true},
+		{`a\b`, nil, true},
+		{"users", []string{"../evil"}, true},
+		{"/abs", nil, true},
+		{".trash", nil, true},
+		{".hidden", nil, true},
+		{"users", []string{".meta"}, true},
+		{"users", []string{"john.doe"}, false},
+	}
+
+	for _, tt := range tests {
+		if err := d.validateName(tt.name, tt.names...); errors.Is(err, ErrInvalidName) != tt.invalid {
+			t.Errorf("validateName(%q, %q) = %v, want invalid %v", tt.name, tt.names, err, tt.invalid)
+		}
+	}
+
+	for _, name := range []string{"../evil", "a/b", filepath.Join(t.TempDir(), "abs")} {
+		var u user
+
+		if err := d.Write("users", name, user{}); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Write(%q) = %v, want ErrInvalidName", name, err)
+		}
+
+		if err := d.Read("users", name, &u); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Read(%q) = %v, want ErrInvalidName", name, err)
+		}
+
+		if err := d.Delete("users", name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Delete(%q) = %v, want ErrInvalidName", name, err)
+		}
+
+		if err := d.Write(name, "john", user{}); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Write to collection %q = %v, want ErrInvalidName", name, err)
+		}
+	}
+}
+
+func TestMissingNames(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	var v interface{}
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"Write collection", d.Write("", "john", user{})},
+		{"Write resource", d.Write("users", "", user{})},
+		{"Read collection", d.Read("", "john", &v)},
+		{"Read resource", d.Read("users", "", &v)},
+		{"ReadAll", func() error { _, err := d.ReadAll(""); return err }()},
+		{"Count", func() error { _, err := d.Count(""); return err }()},
+		{"Exists", func() error { _, err := d.Exists("users", ""); return err }()},
+		{"Update", d.Update("users", "", nil)},
+		{"Rename", d.Rename("users", "john", "")},
+		{"SetSchema", d.SetSchema("", nil)},
+	}
+
+	for _, tt := range tests {
+		if !errors.Is(tt.err, ErrInvalidName) {
+			t.Errorf("%s with a name missing = %v, want ErrInvalidName", tt.name, tt.err)
+		}
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.WriteBatch("users", map[string]interface{}{"john": user{Name: "john"}, "jane": user{Name: "jane"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A record that can't be marshalled stops the whole batch.
+	err := d.WriteBatch("users", map[string]interface{}{"a": user{Name: "a"}, "john": make(chan int)})
+	if err == nil {
+		t.Fatal("WriteBatch with an unmarshalable record succeeded")
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(d.dir, "users"))
+	if len(entries) != 2 {
+		t.Errorf("%d files after a failed batch, want the 2 records", len(entries))
+	}
+
+	var u user
+	if err := d.Read("users", "john", &u); err != nil || u.Name != "john" {
+		t.Errorf("Read(john) = %+v, %v", u, err)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *Options
+		file string
+	}{
+		{"default", nil, "john.json"},
+		{"extension", &Options{FileExtension: ".db"}, "john.db"},
+		{"extension without a dot", &Options{FileExtension: "txt"}, "john.txt"},
+		{"compressed", &Options{Compress: true}, "john.json.gz"},
+		{"compact", &Options{CompactJSON: true}, "john.json"},
+		{"encrypted", &Options{EncryptionKey: bytes.Repeat([]byte{1}, 32)}, "john.json"},
+		{"yaml", &Options{Codec: YAMLCodec{}}, "john.yaml"},
+		{"gob", &Options{Codec: GobCodec{}}, "john.gob"},
+		{"sharded", &Options{ShardDepth: 2}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDriver(t, tt.opts)
+			want := user{Name: "john", Age: 30, Company: "Acme", State: "NY"}
+
+			if err := d.Write("users", "john", want); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.file != "" {
+				if _, err := os.Stat(filepath.Join(d.dir, "users", tt.file)); err != nil {
+					t.Errorf("record not stored as %s: %v", tt.file, err)
+				}
+			}
+
+			if path := d.ResourcePath("users", "john"); !strings.HasPrefix(path, d.Dir()) {
+				t.Errorf("ResourcePath = %s, outside of %s", path, d.Dir())
+			} else if _, err := os.Stat(path); err != nil {
+				t.Errorf("nothing at ResourcePath: %v", err)
+			}
+
+			var got user
+			if err := d.Read("users", "john", &got); err != nil || got != want {
+				t.Errorf("Read = %+v, %v; want %+v", got, err, want)
+			}
+
+			if err := d.Read("users", "jane", &got); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Read(jane) = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestWriteFormatting(t *testing.T) {
+	type record struct {
+		B int `json:"b"`
+		A int `json:"a"`
+	}
+
+	tests := []struct {
+		name string
+		opts *Options
+		want string
+	}{
+		{"indented", nil, "{\n\t\"b\": 2,\n\t\"a\": 1\n}\n"},
+		{"compact", &Options{CompactJSON: true}, "{\"b\":2,\"a\":1}\n"},
+		{"canonical", &Options{CompactJSON: true, CanonicalJSON: true}, "{\"a\":1,\"b\":2}\n"},
+		{"no trailing newline", &Options{CompactJSON: true, NoTrailingNewline: true}, "{\"b\":2,\"a\":1}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDriver(t, tt.opts)
+
+			if err := d.Write("records", "r", record{B: 2, A: 1}); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := d.ReadBytes("records", "r")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(b) != tt.want {
+				t.Errorf("stored %q, want %q", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestClose(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("users", "john", user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var u user
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"Close", d.Close()},
+		{"Write", d.Write("users", "john", user{})},
+		{"Read", d.Read("users", "john", &u)},
+		{"Delete", d.Delete("users", "john")},
+		{"ReadAll", func() error { _, err := d.ReadAll("users"); return err }()},
+	}
+
+	for _, tt := range tests {
+		if !errors.Is(tt.err, ErrClosed) {
+			t.Errorf("%s after Close = %v, want ErrClosed", tt.name, tt.err)
+		}
+	}
+}
+
+// TestConcurrentReadWrite runs readers alongside writers of the same records.
+// Run it with -race.
+func TestConcurrentReadWrite(t *testing.T) {
+	for _, recordLocks := range []bool{false, true} {
+		d := newTestDriver(t, &Options{RecordLocks: recordLocks})
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 8; i++ {
+			wg.Add(2)
+
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < 20; j++ {
+					if err := d.Write("users", fmt.Sprint(j%4), user{Age: j}); err != nil {
+						t.Error(err)
+					}
+				}
+			}()
+
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < 20; j++ {
+					var u user
+					if err := d.Read("users", fmt.Sprint(j%4), &u); err != nil && !errors.Is(err, ErrNotFound) {
+						t.Errorf("Read during writes: %v", err)
+					}
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if n, err := d.Count("users"); err != nil || n != 4 {
+			t.Errorf("RecordLocks %v: Count = %d, %v; want 4", recordLocks, n, err)
+		}
+	}
+}
+
+// TestConcurrentReadPaths runs every read path against writers replacing the
+// same record, each read seeing either the old or the new record in full. Run
+// it with -race.
+func TestConcurrentReadPaths(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reads := map[string]func() error{
+		"Read": func() error {
+			var u user
+			return d.Read("users", "john", &u)
+		},
+		"Exists": func() error {
+			if exists, err := d.Exists("users", "john"); err != nil || !exists {
+				return fmt.Errorf("Exists = %v, %v", exists, err)
+			}
+			return nil
+		},
+		"ReadPage": func() error {
+			page, err := d.ReadPage("users", 0, 1)
+			if err == nil && len(page) != 1 {
+				err = fmt.Errorf("ReadPage = %d records", len(page))
+			}
+			return err
+		},
+		"Each": func() error {
+			return d.Each("users", func(resource string, raw []byte) error {
+				var u user
+				return json.Unmarshal(raw, &u)
+			})
+		},
+		"ReadAllInto": func() error {
+			var all []user
+			return d.ReadAllInto("users", &all)
+		},
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				if err := d.Write("users", "john", user{Name: "john", Age: j}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+
+	for name, read := range reads {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				if err := read(); err != nil {
+					t.Errorf("%s during writes: %v", name, err)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestContext(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("users", "john", user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var u user
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"WriteContext", d.WriteContext(ctx, "users", "john", user{})},
+		{"ReadContext", d.ReadContext(ctx, "users", "john", &u)},
+		{"DeleteContext", d.DeleteContext(ctx, "users", "john")},
+		{"ReadAllContext", func() error { _, err := d.ReadAllContext(ctx, "users"); return err }()},
+	}
+
+	for _, tt := range tests {
+		if !errors.Is(tt.err, context.Canceled) {
+			t.Errorf("%s with a canceled context = %v, want context.Canceled", tt.name, tt.err)
+		}
+	}
+
+	// The lock is held elsewhere until the deadline passes.
+	unlock, err := d.Lock("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	if err := d.WriteWithTimeout("users", "john", user{}, 10*time.Millisecond); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("WriteWithTimeout on a locked collection = %v, want ErrLockTimeout", err)
+	}
+
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := d.ReadContext(timeout, "users", "john", &u); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ReadContext on a locked collection = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// cancelAfter is a context canceled once its Err has been asked n times.
+type cancelAfter struct {
+	context.Context
+
+	n     int
+	calls int
+}
+
+func (c *cancelAfter) Err() error {
+	c.calls++
+
+	if c.calls > c.n {
+		return context.Canceled
+	}
+
+	return nil
+}
+
+func TestReadAllContextCancelMidScan(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for i := 0; i < 10; i++ {
+		if err := d.Write("users", fmt.Sprint(i), user{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Once for the lock, then once before each of the first two files.
+	ctx := &cancelAfter{Context: context.Background(), n: 3}
+
+	records, err := d.ReadAllContext(ctx, "users")
+	if !errors.Is(err, context.Canceled) || records != nil {
+		t.Fatalf("ReadAllContext = %d records, %v; want context.Canceled", len(records), err)
+	}
+
+	if ctx.calls != ctx.n+1 {
+		t.Errorf("ReadAllContext went on after the cancel, checking the context %d times", ctx.calls)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for i := 1; i <= 4; i++ {
+		if err := d.Write("users", fmt.Sprint(i), user{Name: fmt.Sprint(i), Age: i * 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	over := func(age int) func(raw []byte) (bool, error) {
+		return func(raw []byte) (bool, error) {
+			var u user
+			err := json.Unmarshal(raw, &u)
+			return u.Age > age, err
+		}
+	}
+
+	records, err := d.Query("users", over(20))
+	if got := names(t, records); err != nil || !reflect.DeepEqual(got, []string{"3", "4"}) {
+		t.Errorf("Query = %v, %v", got, err)
+	}
+
+	boom := errors.New("boom")
+
+	if _, err := d.Query("users", func([]byte) (bool, error) { return false, boom }); !errors.Is(err, boom) {
+		t.Errorf("Query = %v, want the predicate's error", err)
+	}
+}
+
+func TestRename(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      *Options
+		from, to  string
+		want      error
+		wantFound string
+	}{
+		{"rename", nil, "john", "johnny", nil, "johnny"},
+		{"same name", nil, "john", "john", nil, "john"},
+		{"missing", nil, "nobody", "johnny", ErrNotFound, "john"},
+		{"existing", nil, "john", "jane", ErrExists, "john"},
+		{"overwrite", &Options{AllowOverwrite: true}, "john", "jane", nil, "jane"},
+		{"reserved", nil, "john", "_schema", ErrInvalidName, "john"},
+		{"invalid", nil, "john", "../johnny", ErrInvalidName, "john"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDriver(t, tt.opts)
+
+			if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := d.Write("users", "jane", user{Name: "jane"}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := d.Rename("users", tt.from, tt.to)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Rename(%s, %s) = %v, want %v", tt.from, tt.to, err, tt.want)
+			}
+
+			// Whatever happened, john's record is still around under one name.
+			var u user
+			if err := d.Read("users", tt.wantFound, &u); err != nil || u.Name != "john" {
+				t.Errorf("Read(%s) = %+v, %v", tt.wantFound, u, err)
+			}
+		})
+	}
+}
+
+// The watch package is built on Dir, Logger, Keys and RecordName.
+func TestAccessors(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "db") + "/"
+	logger := quietLogger{}
+
+	d, err := New(dir, &Options{Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if got := d.Dir(); got != filepath.Clean(dir) {
+		t.Errorf("Dir = %s, want %s", got, filepath.Clean(dir))
+	}
+
+	if d.Logger() != logger {
+		t.Errorf("Logger = %v, want the one from Options", d.Logger())
+	}
+
+	if !d.Local() {
+		t.Error("Local = false for the default FileSystem")
+	}
+
+	for _, name := range []string{"jane", "john", "bob"} {
+		if err := d.Write("users", name, user{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if keys, err := d.Keys("users"); err != nil || !reflect.DeepEqual(keys, []string{"bob", "jane", "john"}) {
+		t.Errorf("Keys = %v, %v", keys, err)
+	}
+
+	if _, err := d.Keys("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Keys(missing) = %v, want ErrNotFound", err)
+	}
+
+	tests := []struct {
+		file string
+		want string
+		ok   bool
+	}{
+		{"john.json", "john", true},
+		{"john.json.gz", "john", true},
+		{"john.json.tmp", "", false},
+		{"john.meta", "", false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := d.RecordName("users", tt.file); got != tt.want || ok != tt.ok {
+			t.Errorf("RecordName(%s) = %q, %v; want %q, %v", tt.file, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWriteManyReadMany(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	records := map[string]interface{}{
+		"john": user{Name: "john"},
+		"jane": user{Name: "jane"},
+	}
+
+	if err := d.WriteMany("users", records); err != nil {
+		t.Fatal(err)
+	}
+
+	many, err := d.ReadMany("users", []string{"john", "jane", "nobody"})
+	if err != nil || len(many) != 2 {
+		t.Fatalf("ReadMany = %v, %v", many, err)
+	}
+
+	var u user
+	if err := json.Unmarshal(many["jane"], &u); err != nil || u.Name != "jane" {
+		t.Errorf("ReadMany(jane) = %+v, %v", u, err)
+	}
+
+	// An unmarshalable record stops the writes, keeping those before it.
+	err = d.WriteMany("users", map[string]interface{}{"a": user{}, "b": make(chan int), "c": user{}})
+	if err == nil {
+		t.Fatal("WriteMany with an unmarshalable record succeeded")
+	}
+
+	if n, _ := d.Count("users"); n != 3 {
+		t.Errorf("Count = %d after a failed WriteMany, want 3", n)
+	}
+
+	if err := d.WriteMany("users", map[string]interface{}{"": user{}}); err == nil {
+		t.Error("WriteMany with an empty name succeeded")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	dir := t.TempDir()
+
+	d, err := New(dir, &Options{Logger: quietLogger{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	d.Close()
+
+	d = newTestDriverAt(t, dir, &Options{ReadOnly: true})
+
+	var u user
+	if err := d.Read("users", "john", &u); err != nil || u.Name != "john" {
+		t.Errorf("Read = %+v, %v", u, err)
+	}
+
+	for name, err := range map[string]error{
+		"Write":  d.Write("users", "jane", user{}),
+		"Delete": d.Delete("users", "john"),
+		"Rename": d.Rename("users", "john", "jane"),
+	} {
+		if !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s = %v, want ErrReadOnly", name, err)
+		}
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	tests := []struct {
+		name              string
+		opts              Options
+		wantDir, wantFile os.FileMode
+	}{
+		{"defaults", Options{}, 0755, 0644},
+		{"private", Options{DirPerm: 0700, FilePerm: 0600}, 0700, 0600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDriver(t, &tt.opts)
+
+			if err := d.Write("users", "john", user{}); err != nil {
+				t.Fatal(err)
+			}
+
+			dir, err := os.Stat(filepath.Join(d.dir, "users"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			file, err := os.Stat(filepath.Join(d.dir, "users", "john.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The umask may only take permissions away.
+			if dir.Mode().Perm()&^tt.wantDir != 0 || file.Mode().Perm()&^tt.wantFile != 0 {
+				t.Errorf("permissions %v and %v, want at most %v and %v", dir.Mode().Perm(), file.Mode().Perm(), tt.wantDir, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestStat(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := d.Stat("users", "john")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(filepath.Join(d.dir, "users", "john.json"))
+	if fi.Size() != int64(len(b)) {
+		t.Errorf("Stat size = %d, want %d", fi.Size(), len(b))
+	}
+
+	tests := []struct {
+		since time.Time
+		want  bool
+	}{
+		{fi.ModTime().Add(-time.Second), true},
+		{fi.ModTime(), false},
+		{fi.ModTime().Add(time.Second), false},
+	}
+
+	for _, tt := range tests {
+		var u user
+		if newer, err := d.ReadIfNewer("users", "john", tt.since, &u); err != nil || newer != tt.want || newer && u.Name != "john" {
+			t.Errorf("ReadIfNewer(%s) = %v, %+v, %v; want %v", tt.since, newer, u, err, tt.want)
+		}
+	}
+
+	if _, err := d.Stat("users", "jane"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat(jane) = %v, want ErrNotFound", err)
+	}
+
+	if exists, err := d.Exists("users", "jane"); err != nil || exists {
+		t.Errorf("Exists(jane) = %v, %v", exists, err)
+	}
+}
+
+func TestDeleteAll(t *testing.T) {
+	tests := []struct {
+		name string
+		pred func(raw []byte) (bool, error)
+		want int
+	}{
+		{"all", nil, 3},
+		{"where", func(raw []byte) (bool, error) { return bytes.Contains(raw, []byte(`"Age": 2`)), nil }, 1},
+		{"where none", func(raw []byte) (bool, error) { return false, nil }, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDriver(t, nil)
+
+			for i := 1; i <= 3; i++ {
+				if err := d.Write("users", fmt.Sprint(i), user{Age: i}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var n int
+			var err error
+
+			if tt.pred == nil {
+				n, err = d.DeleteAll("users")
+			} else {
+				n, err = d.DeleteWhere("users", tt.pred)
+			}
+
+			if err != nil || n != tt.want {
+				t.Fatalf("deleted %d, %v; want %d", n, err, tt.want)
+			}
+
+			if left, err := d.Count("users"); err != nil || left != 3-tt.want {
+				t.Errorf("Count = %d, %v; want %d", left, err, 3-tt.want)
+			}
+
+			// The collection itself is kept.
+			if _, err := os.Stat(filepath.Join(d.dir, "users")); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	d := newTestDriver(t, nil)
+
+	if _, err := d.DeleteAll("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteAll(missing) = %v, want ErrNotFound", err)
+	}
+
+	if _, err := d.DeleteWhere("missing", func([]byte) (bool, error) { return true, nil }); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteWhere(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStatPermissionError(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("permissions aren't enforced for root")
+	}
+
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("users", "john", user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(d.dir, "users")
+
+	if err := os.Chmod(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0755)
+
+	if err := d.Delete("users", "john"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete from an unreadable collection = %v, want the permission error", err)
+	}
+}
+
+func TestValidateWrite(t *testing.T) {
+	d := newTestDriver(t, &Options{MaxRecordBytes: 200})
+
+	if err := d.SetSchema("users", []byte(`{"type":"object","required":["Name"],"properties":{"Name":{"type":"string","minLength":1}}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.AddUniqueIndex("users", "Name"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		resource string
+		v        interface{}
+		want     error
+	}{
+		{"valid", "jane", user{Name: "jane"}, nil},
+		{"same record", "john", user{Name: "john"}, nil},
+		{"schema", "jane", user{}, ErrSchemaViolation},
+		{"unique", "jane", user{Name: "john"}, ErrUniqueViolation},
+		{"too large", "jane", user{Name: strings.Repeat("a", 200)}, ErrRecordTooLarge},
+		{"invalid name", "../jane", user{Name: "jane"}, ErrInvalidName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := d.ValidateWrite("users", tt.resource, tt.v)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("ValidateWrite = %v, want %v", err, tt.want)
+			}
+
+			if tt.want != nil {
+				if err := d.Write("users", tt.resource, tt.v); !errors.Is(err, tt.want) {
+					t.Errorf("Write = %v, want %v like ValidateWrite", err, tt.want)
+				}
+			}
+		})
+	}
+
+	if n, _ := d.Count("users"); n != 1 {
+		t.Errorf("Count = %d, ValidateWrite must not write", n)
+	}
+}
+
+func TestReadRawMessage(t *testing.T) {
+	d := newTestDriver(t, &Options{CompactJSON: true})
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var raw json.RawMessage
+	if err := d.Read("users", "john", &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `{"Name":"john","Age":0,"Company":"","State":""}`; string(raw) != want {
+		t.Errorf("Read into json.RawMessage = %s, want %s", raw, want)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	readOnly := filepath.Join(t.TempDir(), "ro")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+		opts Options
+		root bool
+	}{
+		{"file", file, Options{}, true},
+		{"not writable", readOnly, Options{}, false},
+		{"missing read-only", filepath.Join(t.TempDir(), "missing"), Options{ReadOnly: true}, true},
+		{"shard depth", t.TempDir(), Options{ShardDepth: 5}, true},
+		{"encryption key", t.TempDir(), Options{EncryptionKey: []byte("short")}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.root && os.Getuid() == 0 {
+				t.Skip("permissions aren't enforced for root")
+			}
+
+			tt.opts.Logger = quietLogger{}
+
+			if _, err := New(tt.dir, &tt.opts); err == nil {
+				t.Errorf("New(%s) succeeded", tt.dir)
+			}
+		})
+	}
+}
+
+func TestReadMulti(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("orders", "1", map[string]interface{}{"user": "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var john user
+
+	results := map[string]interface{}{"users/john": &john}
+
+	err := d.ReadMulti([]RecordRef{{"users", "john"}, {"orders", "1"}, {"orders", "2"}}, results)
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "orders/2") {
+		t.Errorf("ReadMulti = %v, want ErrNotFound for orders/2", err)
+	}
+
+	if john.Name != "john" {
+		t.Errorf("users/john = %+v", john)
+	}
+
+	if order, ok := results["orders/1"].(map[string]interface{}); !ok || order["user"] != "john" {
+		t.Errorf("orders/1 = %v", results["orders/1"])
+	}
+
+	many, err := d.ReadMany("users", []string{"john", "jane"})
+	if err != nil || len(many) != 1 || many["john"] == nil {
+		t.Errorf("ReadMany = %v, %v", many, err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("accounts", "a", map[string]int{"balance": 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("accounts", "b", map[string]int{"balance": 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+
+	// Transfers are atomic as long as they hold the lock.
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			unlock, err := d.Lock("accounts")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+
+			var a, b map[string]int
+
+			if err := d.ReadLocked("accounts", "a", &a); err != nil {
+				t.Error(err)
+				return
+			}
+
+			if err := d.ReadLocked("accounts", "b", &b); err != nil {
+				t.Error(err)
+				return
+			}
+
+			a["balance"] -= 10
+			b["balance"] += 10
+
+			if err := d.WriteLocked("accounts", "a", a); err != nil {
+				t.Error(err)
+			}
+
+			if err := d.WriteLocked("accounts", "b", b); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	var a, b map[string]int
+
+	d.Read("accounts", "a", &a)
+	d.Read("accounts", "b", &b)
+
+	if a["balance"] != 0 || b["balance"] != 100 {
+		t.Errorf("balances %d and %d, want 0 and 100", a["balance"], b["balance"])
+	}
+
+	if _, err := d.Lock("../accounts"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Lock(../accounts) = %v, want ErrInvalidName", err)
+	}
+
+	unlock, err := d.Lock("accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	if err := d.ReadLocked("accounts", "c", &a); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadLocked(c) = %v, want ErrNotFound", err)
+	}
+
+	if err := d.WriteLocked("accounts", "../c", a); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("WriteLocked(../c) = %v, want ErrInvalidName", err)
+	}
+
+	d.Close()
+
+	if _, err := d.Lock("accounts"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Lock after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestCaseInsensitiveKeys(t *testing.T) {
+	d := newTestDriver(t, &Options{CaseInsensitiveKeys: true})
+
+	if err := d.Write("users", "John", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"john", "JOHN", "John"} {
+		var u user
+		if err := d.Read("users", name, &u); err != nil || u.Name != "john" {
+			t.Errorf("Read(%s) = %+v, %v", name, u, err)
+		}
+	}
+
+	if keys, _ := d.Keys("users"); len(keys) != 1 || keys[0] != "john" {
+		t.Errorf("Keys = %v, want [john]", keys)
+	}
+
+	if err := d.WriteMany("users", map[string]interface{}{"A": user{}, "a": user{}}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("WriteMany with names differing in case = %v, want ErrInvalidName", err)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	tests := []struct {
+		field string
+		delta float64
+		want  float64
+		err   bool
+	}{
+		{"views", 1, 1, false},
+		{"views", 2.5, 3.5, false},
+		{"views", -3.5, 0, false},
+		{"Name", 1, 0, true},
+	}
+
+	if err := d.Write("pages", "home", map[string]interface{}{"Name": "home"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		got, err := d.Increment("pages", "home", tt.field, tt.delta)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("Increment(%s, %v) = %v, %v; want %v", tt.field, tt.delta, got, err, tt.want)
+		}
+	}
+
+	if got, err := d.Increment("pages", "new", "views", 5); err != nil || got != 5 {
+		t.Errorf("Increment of a new record = %v, %v; want 5", got, err)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			d.Increment("pages", "counter", "n", 1)
+		}()
+	}
+
+	wg.Wait()
+
+	if got, _ := d.Increment("pages", "counter", "n", 0); got != 20 {
+		t.Errorf("20 concurrent increments made %v", got)
+	}
+}
+
+func TestMaxConcurrentIO(t *testing.T) {
+	d := newTestDriver(t, &Options{MaxConcurrentIO: 2})
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := d.Write("users", fmt.Sprint(i), user{}); err != nil {
+				t.Error(err)
+			}
+
+			if _, err := d.ReadAll("users"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if len(d.ioSlots) != 0 {
+		t.Errorf("%d IO slots still taken", len(d.ioSlots))
+	}
+}
+
+func TestReadAllSince(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("users", "old", user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := d.Stat("users", "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	since := fi.ModTime()
+
+	// Make sure the next write gets a later modification time.
+	os.Chtimes(filepath.Join(d.dir, "users", "old.json"), since.Add(-time.Hour), since.Add(-time.Hour))
+	since = since.Add(-time.Minute)
+
+	if err := d.Write("users", "new", user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := d.ReadAllSince("users", since)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := records["new"]; !ok || len(records) != 1 {
+		t.Errorf("ReadAllSince = %v, want only new", records)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	d := newTestDriver(t, &Options{MaxNameLength: 10, MaxRecordBytes: 64})
+
+	tests := []struct {
+		name       string
+		collection string
+		resource   string
+		v          interface{}
+		want       error
+	}{
+		{"fits", "users", "john", user{}, nil},
+		{"long resource", "users", strings.Repeat("a", 11), user{}, ErrNameTooLong},
+		{"long collection", strings.Repeat("u", 11), "john", user{}, ErrNameTooLong},
+		{"at the limit", strings.Repeat("u", 10), strings.Repeat("a", 10), user{}, nil},
+		{"large record", "users", "john", user{Name: strings.Repeat("a", 64)}, ErrRecordTooLarge},
+	}
+
+	for _, tt := range tests {
+		err := d.Write(tt.collection, tt.resource, tt.v)
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: Write = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	n := 0
+	if err := d.ConfigureCollection("logs", CollectionOptions{MaxRecordBytes: &n}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("logs", "1", user{Name: strings.Repeat("a", 64)}); err != nil {
+		t.Errorf("Write to a collection without a limit = %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package minidb
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+)
+
+// Migrate rewrites every record of a collection with what fn returns for it,
+// like Update, and returns how many records it rewrote. Records fn returns
+// unchanged are left alone. The collection is locked for the whole migration.
+// The first error, from fn or from writing, stops it, naming the record it
+// failed on; records migrated before then stay migrated.
+func (d *Driver) Migrate(collection string, fn func(raw []byte) ([]byte, error)) (int, error) {
+	if d.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	if collection == "" {
+		return 0, missingName("Missing collection - no place to migrate records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return 0, err
+	}
+
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	migrated := 0
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	files, err := d.listRecords(collection)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	for _, file := range files {
+		resource := d.recordName(collection, file)
+
+		b, err := d.readFile(filepath.Join(dir, file))
+		if err != nil {
+			return migrated, fmt.Errorf("unable to migrate record %s: %w", resource, err)
+		}
+
+		out, err := fn(b)
+		if err != nil {
+			return migrated, fmt.Errorf("unable to migrate record %s: %w", resource, err)
+		}
+
+		if bytes.Equal(out, b) {
+			continue
+		}
+
+		if err := d.writeRecord(collection, resource, out); err != nil {
+			return migrated, fmt.Errorf("unable to migrate record %s: %w", resource, err)
+		}
+
+		if err := d.updateMeta(collection, resource, (*recordMeta).bump); err != nil {
+			return migrated, fmt.Errorf("unable to migrate record %s: %w", resource, err)
+		}
+
+		pending.write(collection, resource, out)
+		migrated++
+	}
+
+	return migrated, nil
+}
@@ -0,0 +1,62 @@
+package minidb
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	d := newTestDriver(t, &Options{CompactJSON: true})
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := d.Write("users", name, user{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rename := func(raw []byte) ([]byte, error) {
+		return bytes.Replace(raw, []byte(`"Name":"b"`), []byte(`"Name":"bee"`), 1), nil
+	}
+
+	if n, err := d.Migrate("users", rename); err != nil || n != 1 {
+		t.Fatalf("Migrate = %d, %v; want 1", n, err)
+	}
+
+	var u user
+	if err := d.Read("users", "b", &u); err != nil || u.Name != "bee" {
+		t.Errorf("migrated b = %+v, %v", u, err)
+	}
+
+	// The first failure stops the migration, keeping what was done.
+	failing := func(raw []byte) ([]byte, error) {
+		if bytes.Contains(raw, []byte(`"Name":"c"`)) {
+			return nil, errors.New("boom")
+		}
+		return bytes.ToUpper(raw), nil
+	}
+
+	n, err := d.Migrate("users", failing)
+	if err == nil || !strings.Contains(err.Error(), "record c") || n != 2 {
+		t.Errorf("Migrate = %d, %v; want 2 and an error naming c", n, err)
+	}
+
+	if err := d.SetSchema("users", []byte(`{"required": ["Email"]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := d.Migrate("users", rename); err != nil || n != 0 {
+		t.Errorf("Migrate changing nothing = %d, %v", n, err)
+	}
+
+	empty := func(raw []byte) ([]byte, error) { return []byte("{}"), nil }
+
+	if _, err := d.Migrate("users", empty); !errors.Is(err, ErrSchemaViolation) {
+		t.Errorf("Migrate against a schema = %v, want ErrSchemaViolation", err)
+	}
+
+	if _, err := d.Migrate("missing", rename); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Migrate(missing) = %v, want ErrNotFound", err)
+	}
+}
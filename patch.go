@@ -0,0 +1,82 @@
+package minidb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// MergePatch applies a JSON merge patch (RFC 7386) to a record, creating the
+// record if it does not exist yet. Unlike Upsert, objects are merged
+// recursively, and a null removes the key it's given for. Anything else,
+// arrays included, replaces the stored value wholesale. The patch itself must
+// be an object.
+func (d *Driver) MergePatch(collection, resource string, patch []byte) (err error) {
+	ctx, end := d.instrument(context.Background(), "MergePatch", collection, resource)
+	defer func() { end(err) }()
+
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to save record!")
+	}
+
+	if resource == "" {
+		return missingName("Missing resource - unable to save record (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(patch))
+
+	// Numbers are kept exact, unless another codec would store them as strings.
+	if _, ok := d.codec.(JSONCodec); ok {
+		dec.UseNumber()
+	}
+
+	var p interface{}
+
+	if err := dec.Decode(&p); err != nil {
+		return fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	obj, ok := p.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid merge patch: expected a JSON object, got %s", bytes.TrimSpace(patch))
+	}
+
+	return d.upsert(ctx, collection, d.canonical(resource), func(doc map[string]interface{}) error {
+		mergePatch(doc, obj)
+		return nil
+	})
+}
+
+// mergePatch applies patch to target in place and returns it.
+func mergePatch(target, patch map[string]interface{}) map[string]interface{} {
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(target, k)
+		case map[string]interface{}:
+			t, ok := target[k].(map[string]interface{})
+			if !ok {
+				t = map[string]interface{}{}
+			}
+
+			target[k] = mergePatch(t, v)
+		default:
+			target[k] = v
+		}
+	}
+
+	return target
+}
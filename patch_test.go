@@ -0,0 +1,58 @@
+package minidb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string
+		patch   string
+		want    string
+		invalid bool
+	}{
+		{"create", "", `{"a": 1}`, `{"a": 1}`, false},
+		{"add", `{"a": 1}`, `{"b": 2}`, `{"a": 1, "b": 2}`, false},
+		{"replace", `{"a": 1}`, `{"a": "x"}`, `{"a": "x"}`, false},
+		{"remove", `{"a": 1, "b": 2}`, `{"a": null}`, `{"b": 2}`, false},
+		{"nested", `{"a": {"b": 1, "c": 2}}`, `{"a": {"b": null, "d": 3}}`, `{"a": {"c": 2, "d": 3}}`, false},
+		{"object over scalar", `{"a": 1}`, `{"a": {"b": 1}}`, `{"a": {"b": 1}}`, false},
+		{"arrays replaced", `{"a": [1, 2]}`, `{"a": [3]}`, `{"a": [3]}`, false},
+		{"big number", `{}`, `{"n": 12345678901234567890}`, `{"n": 12345678901234567890}`, false},
+		{"array patch", `{"a": 1}`, `[1]`, `{"a": 1}`, true},
+		{"invalid patch", `{"a": 1}`, `{`, `{"a": 1}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDriver(t, nil)
+
+			if tt.initial != "" {
+				if err := d.Write("docs", "x", json.RawMessage(tt.initial)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := d.MergePatch("docs", "x", []byte(tt.patch)); (err != nil) != tt.invalid {
+				t.Fatalf("MergePatch = %v, want invalid %v", err, tt.invalid)
+			}
+
+			raw, err := d.ReadBytes("docs", "x")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got, want interface{}
+
+			decodeJSON(raw, &got)
+			decodeJSON([]byte(tt.want), &want)
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("record = %s, want %s", raw, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package minidb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ReadAllSorted returns the records of a collection ordered by the top-level
+// field, comparing numbers numerically and strings lexically (numbers sort
+// before strings). Records missing the field, or holding something else in it,
+// always come last in file name order. Every record has to be read and decoded
+// to sort them, so this is as expensive as ReadAll plus a decode per record.
+func (d *Driver) ReadAllSorted(collection, field string, ascending bool) ([]string, error) {
+	if field == "" {
+		return nil, missingName("Missing field - unable to sort records!")
+	}
+
+	type entry struct {
+		raw string
+		key interface{}
+	}
+
+	var entries []entry
+
+	err := d.Each(collection, func(resource string, raw []byte) error {
+		doc := map[string]interface{}{}
+
+		if err := d.codec.Unmarshal(raw, &doc); err != nil {
+			return fmt.Errorf("unable to decode record %s: %w", resource, err)
+		}
+
+		entries = append(entries, entry{raw: string(raw), key: sortKey(doc[field])})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].key, entries[j].key
+
+		switch {
+		case a == nil || b == nil:
+			return a != nil
+		case ascending:
+			return lessKey(a, b)
+		default:
+			return lessKey(b, a)
+		}
+	})
+
+	records := make([]string, len(entries))
+
+	for i, e := range entries {
+		records[i] = e.raw
+	}
+
+	return records, nil
+}
+
+// sortKey normalizes a decoded value to a float64 or a string, or nil if it
+// can't be ordered.
+func sortKey(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+
+	return nil
+}
+
+func lessKey(a, b interface{}) bool {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			return a < b
+		}
+		return true
+	case string:
+		if b, ok := b.(string); ok {
+			return a < b
+		}
+		return false
+	}
+
+	return false
+}
+
+// FindByPath is FindByField for a field nested in objects, named by a dotted
+// path such as "Address.State". Records missing any key along the path simply
+// don't match. A path without dots is looked up with FindByField, so it can
+// use an index; nested fields are never indexed and always need a scan.
+func (d *Driver) FindByPath(collection, path string, value interface{}) ([]string, error) {
+	if path == "" {
+		return nil, missingName("Missing path - unable to find records!")
+	}
+
+	keys := strings.Split(path, ".")
+
+	if len(keys) == 1 {
+		return d.FindByField(collection, path, value)
+	}
+
+	want, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []string{}
+
+	err = d.Each(collection, func(resource string, raw []byte) error {
+		var doc interface{}
+
+		if err := d.codec.Unmarshal(raw, &doc); err != nil {
+			return fmt.Errorf("unable to decode record %s: %w", resource, err)
+		}
+
+		v, ok := walkPath(doc, keys)
+		if !ok {
+			return nil
+		}
+
+		got, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		if string(got) == string(want) {
+			records = append(records, string(raw))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// walkPath follows keys down through nested objects, reporting false as soon
+// as one is missing or the value it leads to isn't an object.
+func walkPath(v interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		if v, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
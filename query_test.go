@@ -0,0 +1,80 @@
+package minidb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReadAllSorted(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	records := map[string]interface{}{
+		"a": map[string]interface{}{"Name": "a", "Key": 10},
+		"b": map[string]interface{}{"Name": "b", "Key": 9},
+		"c": map[string]interface{}{"Name": "c", "Key": "x"},
+		"d": map[string]interface{}{"Name": "d"},
+		"e": map[string]interface{}{"Name": "e", "Key": true},
+	}
+
+	for resource, v := range records {
+		if err := d.Write("users", resource, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		ascending bool
+		want      []string
+	}{
+		{true, []string{"b", "a", "c", "d", "e"}},
+		{false, []string{"c", "a", "b", "d", "e"}},
+	}
+
+	for _, tt := range tests {
+		sorted, err := d.ReadAllSorted("users", "Key", tt.ascending)
+		if got := names(t, sorted); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ReadAllSorted(ascending %v) = %v, %v; want %v", tt.ascending, got, err, tt.want)
+		}
+	}
+}
+
+func TestFindByPath(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	records := map[string]interface{}{
+		"a": map[string]interface{}{"Name": "a", "Address": map[string]interface{}{"State": "NY", "Geo": map[string]interface{}{"Zone": 1}}},
+		"b": map[string]interface{}{"Name": "b", "Address": map[string]interface{}{"State": "CA"}},
+		"c": map[string]interface{}{"Name": "c", "Address": "NY"},
+		"d": map[string]interface{}{"Name": "d", "State": "NY"},
+	}
+
+	if err := d.WriteMany("users", records); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path  string
+		value interface{}
+		want  []string
+	}{
+		{"Address.State", "NY", []string{"a"}},
+		{"Address.Geo.Zone", 1, []string{"a"}},
+		{"Address.Geo.Zone", "1", nil},
+		{"Address.Missing", "NY", nil},
+		{"State", "NY", []string{"d"}},
+		{"Address.", "NY", nil},
+		{".State", "NY", nil},
+	}
+
+	for _, tt := range tests {
+		found, err := d.FindByPath("users", tt.path, tt.value)
+		if got := names(t, found); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("FindByPath(%s, %v) = %v, %v; want %v", tt.path, tt.value, got, err, tt.want)
+		}
+	}
+
+	if _, err := d.FindByPath("users", "", "NY"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("FindByPath with no path = %v, want ErrInvalidName", err)
+	}
+}
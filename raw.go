@@ -0,0 +1,212 @@
+package minidb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WriteRaw stores data as is under a resource of a collection, in a file
+// named with the given extension, such as ".png", instead of the records'.
+// It's written like a record, through a ".tmp" file renamed into place, and
+// encrypted if the database is, but never marshalled or compressed. Blobs
+// aren't records: ReadAll, Each, Count and the like skip them, and there's
+// no schema, index, TTL or hook involved.
+func (d *Driver) WriteRaw(collection, resource string, data []byte, ext string) (err error) {
+	ctx, end := d.instrument(context.Background(), "WriteRaw", collection, resource)
+	defer func() { end(err) }()
+
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	path, err := d.rawPath(collection, resource, ext)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := d.lockRecord(ctx, collection, d.canonical(resource))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := d.fs.MkdirAll(filepath.Dir(path), d.dirPerm); err != nil {
+		return err
+	}
+
+	if d.aead != nil {
+		if data, err = encrypt(d.aead, data); err != nil {
+			return err
+		}
+	}
+
+	if err := d.writeFile(path, data); err != nil {
+		return err
+	}
+
+	d.counters.writes.Add(1)
+
+	return nil
+}
+
+// ReadRaw returns the data WriteRaw stored under a resource with the given
+// extension.
+func (d *Driver) ReadRaw(collection, resource, ext string) (b []byte, err error) {
+	_, end := d.instrument(context.Background(), "ReadRaw", collection, resource)
+	defer func() { end(err) }()
+
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	path, err := d.rawPath(collection, resource, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	b, err = d.readRawFile(path)
+	if os.IsNotExist(err) {
+		return nil, notFound(err)
+	}
+
+	return b, err
+}
+
+// ReadAllRaw returns the data WriteRaw stored under every resource of a
+// collection with the given extension, keyed by resource name. ReadAll leaves
+// blobs out, so this is how to get them in bulk.
+func (d *Driver) ReadAllRaw(collection, ext string) (map[string][]byte, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	// Checks the collection name and the extension.
+	if _, err := d.rawPath(collection, "x", ext); err != nil {
+		return nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	if _, err := d.stat(collection, dir); err != nil {
+		return nil, notFound(err)
+	}
+
+	files, err := d.collectionFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := map[string][]byte{}
+
+	for _, file := range files {
+		name := filepath.Base(file)
+		if !strings.HasSuffix(name, ext) {
+			continue
+		}
+
+		// Records and the like can end in ext too, such as ".gz".
+		resource := strings.TrimSuffix(name, ext)
+		if _, err := d.rawPath(collection, resource, ext); err != nil {
+			continue
+		}
+
+		b, err := d.readRawFile(filepath.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		blobs[resource] = b
+	}
+
+	return blobs, nil
+}
+
+// DeleteRaw removes the data WriteRaw stored under a resource with the given
+// extension.
+func (d *Driver) DeleteRaw(collection, resource, ext string) (err error) {
+	ctx, end := d.instrument(context.Background(), "DeleteRaw", collection, resource)
+	defer func() { end(err) }()
+
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	path, err := d.rawPath(collection, resource, ext)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := d.lockRecord(ctx, collection, d.canonical(resource))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := d.fs.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return notFound(err)
+		}
+
+		return err
+	}
+
+	d.counters.deletes.Add(1)
+
+	return nil
+}
+
+// rawPath returns the path of a blob, after checking its names. Extensions
+// that would pass the blob off as a record, its metadata, the collection
+// schema or an in-flight file are rejected.
+func (d *Driver) rawPath(collection, resource, ext string) (string, error) {
+	if collection == "" {
+		return "", missingName("Missing collection - no place for blob!")
+	}
+
+	if resource == "" {
+		return "", missingName("Missing resource - unable to find blob (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return "", err
+	}
+
+	resource = d.canonical(resource)
+
+	if !strings.HasPrefix(ext, ".") || len(ext) < 2 || strings.ContainsAny(ext, `/\`) {
+		return "", fmt.Errorf("%w %q - a blob extension starts with a dot", ErrInvalidName, ext)
+	}
+
+	name := resource + ext
+
+	for _, suffix := range []string{d.extFor(collection), d.extFor(collection) + ".gz", metaExt, ".tmp"} {
+		if strings.HasSuffix(name, suffix) {
+			return "", fmt.Errorf("%w %q - reserved for records", ErrInvalidName, ext)
+		}
+	}
+
+	if name == schemaFile {
+		return "", fmt.Errorf("%w %q - reserved for the collection schema", ErrInvalidName, name)
+	}
+
+	return filepath.Join(d.shard(filepath.Join(d.dir, collection), resource), name), nil
+}
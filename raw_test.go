@@ -0,0 +1,145 @@
+package minidb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRawRoundTrip(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("tar archive"))
+	zw.Close()
+
+	blobs := []struct {
+		name string
+		ext  string
+		data []byte
+	}{
+		{"png", ".png", []byte{0x89, 'P', 'N', 'G'}},
+		{"gzipped", ".tar.gz", gz.Bytes()},
+		{"not gzip", ".gz", []byte("plain text")},
+		{"empty", ".bin", []byte{}},
+	}
+
+	for _, opts := range []struct {
+		name string
+		opts *Options
+	}{
+		{"plain", nil},
+		{"encrypted", &Options{EncryptionKey: bytes.Repeat([]byte{1}, 32)}},
+	} {
+		t.Run(opts.name, func(t *testing.T) {
+			d := newTestDriver(t, opts.opts)
+
+			for _, tt := range blobs {
+				if err := d.WriteRaw("files", tt.name, tt.data, tt.ext); err != nil {
+					t.Fatalf("WriteRaw(%s): %v", tt.name, err)
+				}
+
+				b, err := d.ReadRaw("files", tt.name, tt.ext)
+				if err != nil || !bytes.Equal(b, tt.data) {
+					t.Errorf("ReadRaw(%s) = %q, %v; want %q", tt.name, b, err, tt.data)
+				}
+			}
+		})
+	}
+}
+
+func TestRawPath(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	tests := []struct {
+		resource string
+		ext      string
+		want     error
+	}{
+		{"logo", ".png", nil},
+		{"logo", "png", ErrInvalidName},
+		{"logo", ".", ErrInvalidName},
+		{"logo", ".json", ErrInvalidName},
+		{"logo", ".json.gz", ErrInvalidName},
+		{"logo", ".meta", ErrInvalidName},
+		{"logo", ".tmp", ErrInvalidName},
+		{"logo", "./x", ErrInvalidName},
+		{"", ".png", ErrInvalidName},
+		{"../logo", ".png", ErrInvalidName},
+	}
+
+	for _, tt := range tests {
+		_, err := d.rawPath("files", tt.resource, tt.ext)
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("rawPath(%q, %q) = %v, want %v", tt.resource, tt.ext, err, tt.want)
+		}
+	}
+
+	if _, err := d.ReadRaw("files", "missing", ".png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadRaw(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDeleteRaw(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.WriteRaw("files", "logo", []byte("png"), ".png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.WriteRaw("files", "logo", []byte("svg"), ".svg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DeleteRaw("files", "logo", ".png"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.ReadRaw("files", "logo", ".png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadRaw after DeleteRaw = %v, want ErrNotFound", err)
+	}
+
+	if b, err := d.ReadRaw("files", "logo", ".svg"); err != nil || string(b) != "svg" {
+		t.Errorf("DeleteRaw removed the other extension: %q, %v", b, err)
+	}
+
+	if err := d.DeleteRaw("files", "logo", ".png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second DeleteRaw = %v, want ErrNotFound", err)
+	}
+
+	if err := d.DeleteRaw("files", "logo", ".json"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("DeleteRaw of a record = %v, want ErrInvalidName", err)
+	}
+}
+
+func TestReadAllRaw(t *testing.T) {
+	d := newTestDriver(t, &Options{Compress: true})
+
+	if err := d.Write("files", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, ext := range map[string]string{"a": ".gz", "b": ".gz", "c": ".png"} {
+		if err := d.WriteRaw("files", name, []byte(name), ext); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := d.ReadAllRaw("files", ".gz")
+	if want := map[string][]byte{"a": []byte("a"), "b": []byte("b")}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadAllRaw = %q, %v; want %q", got, err, want)
+	}
+
+	if records, err := d.ReadAll("files"); err != nil || len(records) != 1 {
+		t.Errorf("ReadAll = %q, %v; blobs must be left out", records, err)
+	}
+
+	if _, err := d.ReadAllRaw("files", ".json"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("ReadAllRaw(.json) = %v, want ErrInvalidName", err)
+	}
+
+	if _, err := d.ReadAllRaw("missing", ".gz"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadAllRaw(missing) = %v, want ErrNotFound", err)
+	}
+}
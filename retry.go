@@ -0,0 +1,52 @@
+package minidb
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy makes the Driver try reading and writing record files again
+// when they fail with an error that tends to go away by itself, as happens on
+// network filesystems. Other errors, such as a missing file or a permission
+// error, fail right away.
+type RetryPolicy struct {
+	// Attempts is how many times an operation is tried in all. Zero and one
+	// both mean it isn't retried.
+	Attempts int
+
+	// Backoff is how long to wait before the first retry. It doubles for
+	// every retry after that.
+	Backoff time.Duration
+}
+
+// retryableErrors are the errors RetryPolicy retries on.
+var retryableErrors = []error{syscall.EAGAIN, syscall.EINTR, syscall.EBUSY, syscall.ESTALE, syscall.ETIMEDOUT}
+
+func retryable(err error) bool {
+	for _, target := range retryableErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retry runs op, running it again as the retry policy allows for as long as it
+// fails with a retryable error.
+func (d *Driver) retry(op func() error) error {
+	err := op()
+	wait := d.retryPolicy.Backoff
+
+	for attempt := 1; attempt < d.retryPolicy.Attempts && retryable(err); attempt++ {
+		d.log.Debug("Retrying after '%s' in %s \n", err, wait)
+
+		time.Sleep(wait)
+		wait *= 2
+
+		err = op()
+	}
+
+	return err
+}
@@ -0,0 +1,362 @@
+package minidb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// schemaFile is the reserved file, inside a collection's directory, that holds
+// the collection's JSON Schema.
+const schemaFile = "_schema.json"
+
+var ErrSchemaViolation = errors.New("record does not match the collection schema")
+
+// schema is the subset of JSON Schema that collections can be validated
+// against: type, enum, properties, required, additionalProperties, items,
+// minLength, maxLength, pattern, minimum and maximum.
+type schema struct {
+	Type                 interface{}        `json:"type"`
+	Enum                 []interface{}      `json:"enum"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+
+	pattern *regexp.Regexp
+}
+
+func parseSchema(b []byte) (*schema, error) {
+	s := &schema{}
+
+	if err := decodeJSON(b, s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	if err := s.compile(); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	return s, nil
+}
+
+func (s *schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = re
+	}
+
+	for _, p := range s.Properties {
+		if err := p.compile(); err != nil {
+			return err
+		}
+	}
+
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+
+	return nil
+}
+
+// SetSchema attaches a JSON Schema to a collection. From then on every write
+// to the collection is validated against it and rejected with an error
+// wrapping ErrSchemaViolation if it doesn't match. The schema is saved in the
+// collection directory, so it survives restarts. An empty schema removes it.
+func (d *Driver) SetSchema(collection string, schema []byte) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to save schema!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	dir := filepath.Join(d.dir, collection)
+	path := filepath.Join(dir, schemaFile)
+
+	if len(bytes.TrimSpace(schema)) == 0 {
+		if err := d.fs.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		d.schemas.Delete(collection)
+
+		return nil
+	}
+
+	s, err := parseSchema(schema)
+	if err != nil {
+		return err
+	}
+
+	if err := d.fs.MkdirAll(dir, d.dirPerm); err != nil {
+		return err
+	}
+
+	if err := d.writeFile(path, schema); err != nil {
+		return err
+	}
+
+	d.schemas.Store(collection, s)
+
+	return nil
+}
+
+// schemaFor returns the schema of a collection, or nil if it has none. Schemas
+// are loaded from disk the first time they are needed.
+func (d *Driver) schemaFor(collection string) (*schema, error) {
+	if s, ok := d.schemas.Load(collection); ok {
+		return s.(*schema), nil
+	}
+
+	b, err := d.fs.ReadFile(filepath.Join(d.dir, collection, schemaFile))
+	if os.IsNotExist(err) {
+		d.schemas.Store(collection, (*schema)(nil))
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := parseSchema(b)
+	if err != nil {
+		return nil, err
+	}
+
+	d.schemas.Store(collection, s)
+
+	return s, nil
+}
+
+// validate checks a marshalled record against its collection's schema.
+func (d *Driver) validate(collection string, b []byte) error {
+	s, err := d.schemaFor(collection)
+	if err != nil || s == nil {
+		return err
+	}
+
+	// Round-trip through JSON so that records of any codec are validated the
+	// same way, with numbers kept as json.Number.
+	var doc interface{}
+
+	if err := d.codec.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+
+	j, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	if err := decodeJSON(j, &doc); err != nil {
+		return err
+	}
+
+	var problems []string
+
+	s.check("", doc, &problems)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrSchemaViolation, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+func (s *schema) check(path string, v interface{}, problems *[]string) {
+	field := path
+	if field == "" {
+		field = "(root)"
+	}
+
+	fail := func(format string, args ...interface{}) {
+		*problems = append(*problems, field+": "+fmt.Sprintf(format, args...))
+	}
+
+	if types := s.types(); len(types) > 0 {
+		matched := false
+
+		for _, t := range types {
+			if hasType(v, t) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			fail("expected %s, got %s", strings.Join(types, " or "), typeOf(v))
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		matched := false
+
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, v) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			fail("value is not one of the allowed values")
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*problems = append(*problems, join(path, name)+": is required")
+			}
+		}
+
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if p, ok := s.Properties[name]; ok {
+				p.check(join(path, name), v[name], problems)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*problems = append(*problems, join(path, name)+": is not allowed")
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.check(fmt.Sprintf("%s[%d]", path, i), item, problems)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters long", *s.MinLength)
+		}
+
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters long", *s.MaxLength)
+		}
+
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match pattern %q", s.Pattern)
+		}
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			fail("invalid number %s", v)
+			return
+		}
+
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+		}
+
+		if s.Maximum != nil && f > *s.Maximum {
+			fail("must be at most %v", *s.Maximum)
+		}
+	}
+}
+
+func (s *schema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, v := range t {
+			if name, ok := v.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+
+	return nil
+}
+
+func hasType(v interface{}, t string) bool {
+	if t == "integer" {
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+
+		if _, err := n.Int64(); err == nil {
+			return true
+		}
+
+		f, err := n.Float64()
+		return err == nil && f == float64(int64(f))
+	}
+
+	return typeOf(v) == t
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+func decodeJSON(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	return dec.Decode(v)
+}
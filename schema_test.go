@@ -0,0 +1,96 @@
+package minidb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	err := d.SetSchema("users", []byte(`{
+		"type": "object",
+		"required": ["name"],
+		"additionalProperties": false,
+		"properties": {
+			"name": {"type": "string", "minLength": 2, "maxLength": 8, "pattern": "^[a-z]+$"},
+			"age": {"type": "integer", "minimum": 0, "maximum": 150},
+			"role": {"enum": ["admin", "user"]},
+			"tags": {"type": "array", "items": {"type": "string"}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		record string
+		valid  bool
+	}{
+		{"valid", `{"name": "john", "age": 30, "role": "admin", "tags": ["a"]}`, true},
+		{"only required", `{"name": "john"}`, true},
+		{"missing required", `{"age": 30}`, false},
+		{"additional", `{"name": "john", "email": "j@x"}`, false},
+		{"wrong type", `{"name": 5}`, false},
+		{"too short", `{"name": "j"}`, false},
+		{"too long", `{"name": "johnjohnjohn"}`, false},
+		{"pattern", `{"name": "John"}`, false},
+		{"not integer", `{"name": "john", "age": 1.5}`, false},
+		{"below minimum", `{"name": "john", "age": -1}`, false},
+		{"above maximum", `{"name": "john", "age": 151}`, false},
+		{"enum", `{"name": "john", "role": "root"}`, false},
+		{"items", `{"name": "john", "tags": [1]}`, false},
+		{"not object", `["john"]`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v interface{}
+			if err := decodeJSON([]byte(tt.record), &v); err != nil {
+				t.Fatal(err)
+			}
+
+			err := d.Write("users", "record", v)
+			if tt.valid && err != nil || !tt.valid && !errors.Is(err, ErrSchemaViolation) {
+				t.Errorf("Write(%s) = %v, valid %v", tt.record, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestSetSchema(t *testing.T) {
+	dir := t.TempDir()
+	d := newTestDriverAt(t, dir, nil)
+
+	for _, schema := range []string{`{"type":`, `{"pattern": "("}`} {
+		if err := d.SetSchema("users", []byte(schema)); err == nil {
+			t.Errorf("SetSchema(%s) accepted an invalid schema", schema)
+		}
+	}
+
+	if err := d.SetSchema("users", []byte(`{"required": ["Name"]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The schema is saved with the collection.
+	d.Close()
+	d = newTestDriverAt(t, dir, nil)
+
+	if err := d.Write("users", "john", map[string]string{}); !errors.Is(err, ErrSchemaViolation) {
+		t.Errorf("Write after reopening = %v, want ErrSchemaViolation", err)
+	}
+
+	// An empty schema removes it.
+	if err := d.SetSchema("users", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("users", "john", map[string]string{}); err != nil {
+		t.Errorf("Write without a schema = %v", err)
+	}
+
+	if keys, _ := d.Keys("users"); len(keys) != 1 {
+		t.Errorf("Keys = %v, the schema file must not be listed", keys)
+	}
+}
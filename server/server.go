@@ -0,0 +1,173 @@
+// Package server exposes a Driver over a small REST API. It lives apart from
+// the database package so that library users don't depend on net/http.
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	minidb "github.com/arnabry11/mini-database"
+)
+
+// Server routes
+//
+//	GET    /{collection}             to ReadAll, as a JSON array
+//	GET    /{collection}/{resource}  to Read
+//	PUT    /{collection}/{resource}  to Write, with the record as the JSON body
+//	DELETE /{collection}/{resource}  to Delete
+//
+// to the Driver it wraps. Records are always sent and received as JSON,
+// whatever Codec the Driver stores them with.
+type Server struct {
+	d   *minidb.Driver
+	mux *http.ServeMux
+}
+
+func NewServer(d *minidb.Driver) http.Handler {
+	s := &Server{d: d, mux: http.NewServeMux()}
+
+	s.mux.HandleFunc("GET /{collection}", s.readAll)
+	s.mux.HandleFunc("GET /{collection}/{resource}", s.read)
+	s.mux.HandleFunc("PUT /{collection}/{resource}", s.write)
+	s.mux.HandleFunc("DELETE /{collection}/{resource}", s.delete)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) readAll(w http.ResponseWriter, r *http.Request) {
+	raws, err := s.d.ReadAll(r.PathValue("collection"))
+	if err != nil {
+		fail(w, err)
+		return
+	}
+
+	records := make([]interface{}, 0, len(raws))
+
+	for _, raw := range raws {
+		record, ok := decode([]byte(raw))
+		if !ok {
+			records = []interface{}{}
+
+			if err := s.d.ReadAllInto(r.PathValue("collection"), &records); err != nil {
+				fail(w, err)
+				return
+			}
+
+			break
+		}
+
+		records = append(records, record)
+	}
+
+	respond(w, records)
+}
+
+func (s *Server) read(w http.ResponseWriter, r *http.Request) {
+	raw, err := s.d.ReadBytes(r.PathValue("collection"), r.PathValue("resource"))
+	if err != nil {
+		fail(w, err)
+		return
+	}
+
+	record, ok := decode(raw)
+	if !ok {
+		if err := s.d.Read(r.PathValue("collection"), r.PathValue("resource"), &record); err != nil {
+			fail(w, err)
+			return
+		}
+	}
+
+	respond(w, record)
+}
+
+func (s *Server) write(w http.ResponseWriter, r *http.Request) {
+	var record interface{}
+
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+
+	if err := dec.Decode(&record); err != nil {
+		http.Error(w, fmt.Sprintf("invalid record: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.d.Write(r.PathValue("collection"), r.PathValue("resource"), record); err != nil {
+		fail(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	// Delete without a resource drops the whole collection, which this route
+	// must never do.
+	if r.PathValue("resource") == "" {
+		http.Error(w, "missing resource", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.d.Delete(r.PathValue("collection"), r.PathValue("resource")); err != nil {
+		fail(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decode decodes a stored JSON record keeping its numbers exact, as write
+// does, and reports false for records stored with a Codec other than JSON,
+// which are left for the Driver to decode.
+func decode(raw []byte) (interface{}, bool) {
+	if !json.Valid(raw) {
+		return nil, false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	var record interface{}
+
+	if err := dec.Decode(&record); err != nil {
+		return nil, false
+	}
+
+	return record, true
+}
+
+func respond(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// fail reports a Driver error with the status code matching it.
+func fail(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, minidb.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, minidb.ErrInvalidName), errors.Is(err, minidb.ErrNameTooLong), errors.Is(err, minidb.ErrSchemaViolation):
+		status = http.StatusBadRequest
+	case errors.Is(err, minidb.ErrUniqueViolation), errors.Is(err, minidb.ErrExists):
+		status = http.StatusConflict
+	case errors.Is(err, minidb.ErrRecordTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, minidb.ErrReadOnly):
+		status = http.StatusForbidden
+	case errors.Is(err, minidb.ErrClosed):
+		status = http.StatusServiceUnavailable
+	}
+
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	minidb "github.com/arnabry11/mini-database"
+)
+
+type quietLogger struct{}
+
+func (quietLogger) Fatal(string, ...interface{}) {}
+func (quietLogger) Error(string, ...interface{}) {}
+func (quietLogger) Warn(string, ...interface{})  {}
+func (quietLogger) Info(string, ...interface{})  {}
+func (quietLogger) Debug(string, ...interface{}) {}
+func (quietLogger) Trace(string, ...interface{}) {}
+
+func newTestServer(t *testing.T, opts *minidb.Options) (*minidb.Driver, http.Handler) {
+	t.Helper()
+
+	if opts == nil {
+		opts = &minidb.Options{}
+	}
+
+	opts.Logger = quietLogger{}
+
+	d, err := minidb.New(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { d.Close() })
+
+	return d, NewServer(d)
+}
+
+func TestStatusCodes(t *testing.T) {
+	d, srv := newTestServer(t, &minidb.Options{MaxNameLength: 8, MaxRecordBytes: 64})
+
+	if err := d.Write("users", "john", map[string]string{"name": "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"read", "GET", "/users/john", "", http.StatusOK},
+		{"read all", "GET", "/users", "", http.StatusOK},
+		{"read missing", "GET", "/users/jane", "", http.StatusNotFound},
+		{"read missing collection", "GET", "/orders", "", http.StatusNotFound},
+		{"write", "PUT", "/users/jane", `{"name":"jane"}`, http.StatusNoContent},
+		{"write invalid json", "PUT", "/users/jane", `{`, http.StatusBadRequest},
+		{"write invalid name", "PUT", "/users/a%5Cb", `{}`, http.StatusBadRequest},
+		{"write long name", "PUT", "/users/" + strings.Repeat("a", 9), `{}`, http.StatusBadRequest},
+		{"write too large", "PUT", "/users/jane", `{"name":"` + strings.Repeat("a", 64) + `"}`, http.StatusRequestEntityTooLarge},
+		{"read long name", "GET", "/users/" + strings.Repeat("a", 9), "", http.StatusBadRequest},
+		{"delete", "DELETE", "/users/jane", "", http.StatusNoContent},
+		{"delete missing", "DELETE", "/users/jane", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.want {
+				t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestReadKeepsNumbers(t *testing.T) {
+	for _, codec := range []minidb.Codec{minidb.JSONCodec{}, minidb.YAMLCodec{}} {
+		_, srv := newTestServer(t, &minidb.Options{Codec: codec})
+
+		const record = `{"id":9007199254740993,"price":0.1}`
+
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest("PUT", "/items/a", strings.NewReader(record)))
+
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("PUT = %d: %s", rec.Code, rec.Body)
+		}
+
+		for _, path := range []string{"/items/a", "/items"} {
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+			if _, ok := codec.(minidb.JSONCodec); ok && !strings.Contains(rec.Body.String(), "9007199254740993") {
+				t.Errorf("GET %s = %s, want the id kept exact", path, rec.Body)
+			}
+
+			if rec.Code != http.StatusOK {
+				t.Errorf("GET %s with %T = %d: %s", path, codec, rec.Code, rec.Body)
+			}
+		}
+	}
+}
+
+func TestFail(t *testing.T) {
+	d, _ := newTestServer(t, nil)
+
+	var v interface{}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"missing collection", d.Read("", "john", &v), http.StatusBadRequest},
+		{"missing resource", d.Read("users", "", &v), http.StatusBadRequest},
+		{"missing collection to write", d.Write("", "john", v), http.StatusBadRequest},
+		{"not found", d.Read("users", "john", &v), http.StatusNotFound},
+		{"schema", fmt.Errorf("%w: name is required", minidb.ErrSchemaViolation), http.StatusBadRequest},
+		{"unique", fmt.Errorf("%w: name is taken", minidb.ErrUniqueViolation), http.StatusConflict},
+		{"exists", minidb.ErrExists, http.StatusConflict},
+		{"read-only", minidb.ErrReadOnly, http.StatusForbidden},
+		{"closed", minidb.ErrClosed, http.StatusServiceUnavailable},
+		{"other", errors.New("disk on fire"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		fail(rec, tt.err)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: fail(%v) = %d, want %d", tt.name, tt.err, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestConstraintStatusCodes(t *testing.T) {
+	d, srv := newTestServer(t, nil)
+
+	if err := d.SetSchema("users", []byte(`{"required": ["name"]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.AddUniqueIndex("users", "name"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"PUT", "/users/john", `{"name":"john"}`, http.StatusNoContent},
+		{"PUT", "/users/jane", `{"age":1}`, http.StatusBadRequest},
+		{"PUT", "/users/jane", `{"name":"john"}`, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+		if rec.Code != tt.want {
+			t.Errorf("%s %s %s = %d, want %d: %s", tt.method, tt.path, tt.body, rec.Code, tt.want, rec.Body)
+		}
+	}
+
+	d.Close()
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest("GET", "/users/john", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET after Close = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,75 @@
+package minidb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxShardDepth is the deepest fan-out supported: each level takes two hex
+// digits of a 32-bit hash.
+const maxShardDepth = 4
+
+// shard returns the directory, inside the collection directory dir, that a
+// record is stored in. With ShardDepth set that is a subdirectory per level,
+// named after the hash of the record's name, such as "ab/cd" for two levels.
+func (d *Driver) shard(dir, resource string) string {
+	if d.shardDepth == 0 {
+		return dir
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(resource))
+	sum := fmt.Sprintf("%08x", h.Sum32())
+
+	parts := []string{dir}
+
+	for i := 0; i < d.shardDepth; i++ {
+		parts = append(parts, sum[2*i:2*i+2])
+	}
+
+	return filepath.Join(parts...)
+}
+
+// collectionFiles returns the paths, relative to the collection directory dir,
+// of the files holding the collection's records and their metadata, looking
+// through the shard directories if there are any. They're sorted by file
+// name, regardless of the shard they're in. Hidden directories, such as the
+// one holding indexes, are left out.
+func (d *Driver) collectionFiles(dir string) ([]string, error) {
+	var files []string
+
+	err := d.walkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if path != dir && (d.shardDepth == 0 || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, rel)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return filepath.Base(files[i]) < filepath.Base(files[j])
+	})
+
+	return files, nil
+}
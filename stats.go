@@ -0,0 +1,163 @@
+package minidb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// Stats is a snapshot of what a Driver has done since it was opened.
+type Stats struct {
+	// Reads counts the records read, from disk or from the cache, including
+	// those read internally, such as by Update or while rebuilding an index.
+	Reads uint64
+
+	// Writes and Deletes count the records written and deleted.
+	Writes  uint64
+	Deletes uint64
+
+	// CacheHits and CacheMisses count Read lookups in the cache, and stay at
+	// zero without one.
+	CacheHits   uint64
+	CacheMisses uint64
+
+	// Records holds the number of records of each collection, counted when
+	// the snapshot is taken.
+	Records map[string]int
+}
+
+type counters struct {
+	reads   atomic.Uint64
+	writes  atomic.Uint64
+	deletes atomic.Uint64
+}
+
+// Stats returns the Driver's counters along with the record count of every
+// collection. Collections that can't be counted are left out.
+func (d *Driver) Stats() Stats {
+	stats := Stats{
+		Reads:   d.counters.reads.Load(),
+		Writes:  d.counters.writes.Load(),
+		Deletes: d.counters.deletes.Load(),
+		Records: map[string]int{},
+	}
+
+	if d.cache != nil {
+		stats.CacheHits = d.cache.hits.Load()
+		stats.CacheMisses = d.cache.misses.Load()
+	}
+
+	collections, err := d.Collections()
+	if err != nil {
+		return stats
+	}
+
+	for _, collection := range collections {
+		if n, err := d.Count(collection); err == nil {
+			stats.Records[collection] = n
+		}
+	}
+
+	return stats
+}
+
+// CollectionSize returns the bytes taken on disk by the record files of a
+// collection, expired ones included, as stored: compressed or encrypted
+// records count at their stored size. Nothing is read but the directory.
+func (d *Driver) CollectionSize(collection string) (int64, error) {
+	if d.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	if collection == "" {
+		return 0, missingName("Missing collection - no place to measure!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return 0, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	files, err := d.collectionFiles(dir)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	var size int64
+
+	for _, file := range files {
+		if !d.isRecordName(collection, filepath.Base(file)) {
+			continue
+		}
+
+		fi, err := d.fs.Stat(filepath.Join(dir, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		size += fi.Size()
+	}
+
+	return size, nil
+}
+
+// DatabaseSize is CollectionSize summed over every collection.
+func (d *Driver) DatabaseSize() (int64, error) {
+	collections, err := d.Collections()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+
+	for _, collection := range collections {
+		size, err := d.CollectionSize(collection)
+		if err != nil {
+			return 0, fmt.Errorf("unable to measure collection %s: %w", collection, err)
+		}
+
+		total += size
+	}
+
+	return total, nil
+}
+
+// FieldStats returns, for every top-level field found in the records of a
+// collection, how many records have it, to show how far records written by
+// different versions of an application have drifted apart. Records that
+// aren't objects have no fields. A record that fails to decode aborts the
+// scan.
+func (d *Driver) FieldStats(collection string) (map[string]int, error) {
+	fields := map[string]int{}
+
+	err := d.Each(collection, func(resource string, raw []byte) error {
+		var doc interface{}
+
+		if err := d.codec.Unmarshal(raw, &doc); err != nil {
+			return fmt.Errorf("unable to decode record %s: %w", resource, err)
+		}
+
+		if obj, ok := doc.(map[string]interface{}); ok {
+			for field := range obj {
+				fields[field]++
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
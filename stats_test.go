@@ -0,0 +1,108 @@
+package minidb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	d := newTestDriver(t, &Options{CacheSize: 10})
+
+	for _, name := range []string{"a", "b"} {
+		if err := d.Write("users", name, user{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := d.Write("orders", "1", user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var u user
+
+	d.Read("users", "a", &u)
+	d.Read("users", "a", &u)
+	d.Read("users", "missing", &u)
+
+	if err := d.Delete("orders", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	got := d.Stats()
+	want := Stats{
+		Reads:       2,
+		Writes:      3,
+		Deletes:     1,
+		CacheHits:   1,
+		CacheMisses: 2,
+		Records:     map[string]int{"users": 2, "orders": 0},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestSizes(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	if err := d.Write("users", "john", user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Write("orders", "1", map[string]int{"total": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	size := func(collection, resource string) int64 {
+		fi, err := os.Stat(filepath.Join(d.dir, collection, resource+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Size()
+	}
+
+	if got, err := d.CollectionSize("users"); err != nil || got != size("users", "john") {
+		t.Errorf("CollectionSize = %d, %v; want %d", got, err, size("users", "john"))
+	}
+
+	want := size("users", "john") + size("orders", "1")
+
+	if got, err := d.DatabaseSize(); err != nil || got != want {
+		t.Errorf("DatabaseSize = %d, %v; want %d", got, err, want)
+	}
+
+	if _, err := d.CollectionSize("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CollectionSize(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFieldStats(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	records := map[string]interface{}{
+		"a": map[string]interface{}{"name": "a", "age": 1},
+		"b": map[string]interface{}{"name": "b", "email": "b@x"},
+		"c": []int{1, 2},
+	}
+
+	if err := d.WriteMany("users", records); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := d.FieldStats("users")
+	if want := map[string]int{"name": 2, "age": 1, "email": 1}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("FieldStats = %v, %v; want %v", got, err, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(d.dir, "users", "d.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.FieldStats("users"); err == nil {
+		t.Error("FieldStats over an undecodable record succeeded")
+	}
+}
@@ -0,0 +1,331 @@
+package minidb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// WriteStream stores what r yields as a record, without marshalling it,
+// streaming it through the ".tmp" file into place rather than holding it in
+// memory. It's compressed if the collection is; with EncryptionKey set it has
+// to be read in full to be encrypted. Streamed records can't be checked
+// against a schema or indexed, so collections with either refuse them with
+// errors.ErrUnsupported. MaxRecordBytes is enforced as the record comes in.
+// Hooks are called as for Write, which means that while any are subscribed
+// the record is held in memory after all, to be handed to them.
+func (d *Driver) WriteStream(collection, resource string, r io.Reader) (err error) {
+	ctx, end := d.instrument(context.Background(), "WriteStream", collection, resource)
+	defer func() { end(err) }()
+
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to save record!")
+	}
+
+	if resource == "" {
+		return missingName("Missing resource - unable to save record (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return err
+	}
+
+	resource = d.canonical(resource)
+
+	if d.reserved(collection, resource) {
+		return fmt.Errorf("%w %q - reserved for the collection schema", ErrInvalidName, resource)
+	}
+
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	unlock, err := d.lockRecord(ctx, collection, resource)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := d.checkStreamable(collection); err != nil {
+		return err
+	}
+
+	if limit := d.recordLimit(collection); limit > 0 {
+		r = &limitedReader{r: r, n: limit, err: fmt.Errorf("%w: %s is over the limit of %d bytes", ErrRecordTooLarge, resource, limit)}
+	}
+
+	// Hooks get the whole record, so it's only kept when there are any.
+	var raw *bytes.Buffer
+	if len(d.subscribers()) > 0 {
+		raw = &bytes.Buffer{}
+		r = io.TeeReader(r, raw)
+	}
+
+	path := d.recordPath(collection, resource)
+
+	if err := d.fs.MkdirAll(filepath.Dir(path), d.dirPerm); err != nil {
+		return err
+	}
+
+	d.cache.remove(cacheKey(collection, resource))
+
+	if d.aead != nil {
+		var b []byte
+
+		if b, err = io.ReadAll(r); err != nil {
+			return err
+		}
+
+		if b, err = d.encode(collection, b); err != nil {
+			return err
+		}
+
+		err = d.writeFile(path, b)
+	} else {
+		err = d.streamFile(path, r, d.compressed(collection))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	d.removeStale(collection, resource)
+	d.counters.writes.Add(1)
+
+	err = d.updateMeta(collection, resource, func(m *recordMeta) {
+		m.setTTL(d.ttl, d.clock.Now())
+		m.bump()
+	})
+	if err != nil {
+		return err
+	}
+
+	if raw != nil {
+		pending.write(collection, resource, raw.Bytes())
+	}
+
+	return nil
+}
+
+// checkStreamable reports why records can't be streamed into the collection,
+// if there's a reason.
+func (d *Driver) checkStreamable(collection string) error {
+	s, err := d.schemaFor(collection)
+	if err != nil {
+		return err
+	}
+
+	if s != nil {
+		return fmt.Errorf("%w: '%s' has a schema, records must be written with Write", errors.ErrUnsupported, collection)
+	}
+
+	d.indexMutex.Lock()
+	indexes, err := d.loadIndexes(collection)
+	d.indexMutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if len(indexes) > 0 {
+		return fmt.Errorf("%w: '%s' has indexes, records must be written with Write", errors.ErrUnsupported, collection)
+	}
+
+	return nil
+}
+
+// limitedReader fails with err once more than n bytes have been read.
+type limitedReader struct {
+	r   io.Reader
+	n   int
+	err error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+
+	if l.n -= n; l.n < 0 {
+		return n, l.err
+	}
+
+	return n, err
+}
+
+// ReadStream opens a record for reading its stored bytes as they come off the
+// disk, decompressed but not decoded. The caller must close it. The record can
+// be replaced while it's being read, in which case the default FileSystem
+// keeps yielding the version that was opened. Encrypted records are read in
+// full to be decrypted.
+func (d *Driver) ReadStream(collection, resource string) (rc io.ReadCloser, err error) {
+	_, end := d.instrument(context.Background(), "ReadStream", collection, resource)
+	defer func() { end(err) }()
+
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	if collection == "" {
+		return nil, missingName("Missing collection - no place to read record!")
+	}
+
+	if resource == "" {
+		return nil, missingName("Missing resource - unable to read record (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return nil, err
+	}
+
+	resource = d.canonical(resource)
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	path, _, err := d.recordFile(collection, resource)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if d.aead != nil {
+		b, err := d.readFile(path)
+		if err != nil {
+			return nil, notFound(err)
+		}
+
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+
+	f, err := d.openFile(path)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	d.counters.reads.Add(1)
+
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return gzipFile{zr, f}, nil
+}
+
+// streamFile copies r to path through a ".tmp" file, like writeFile,
+// gzipping it on the way if compress is set.
+func (d *Driver) streamFile(path string, r io.Reader, compress bool) error {
+	tmpPath := path + ".tmp"
+
+	w, err := d.createFile(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	if compress {
+		zw := gzip.NewWriter(w)
+
+		_, err = io.Copy(zw, r)
+		if err == nil {
+			err = zw.Close()
+		}
+	} else {
+		_, err = io.Copy(w, r)
+	}
+
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil && d.durability == DurabilitySync {
+		err = d.sync(tmpPath)
+	}
+
+	if err != nil {
+		d.fs.Remove(tmpPath)
+		return err
+	}
+
+	err = d.retry(func() error {
+		return d.fs.Rename(tmpPath, path)
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.persisted(path)
+}
+
+// createFile opens a file for writing, creating or truncating it. FileSystems
+// without a method Create(name string, perm fs.FileMode) (io.WriteCloser,
+// error) get what's written in one WriteFile when it's closed.
+func (d *Driver) createFile(name string) (io.WriteCloser, error) {
+	if c, ok := d.fs.(interface {
+		Create(name string, perm fs.FileMode) (io.WriteCloser, error)
+	}); ok {
+		return c.Create(name, d.filePerm)
+	}
+
+	return &bufferedFile{write: func(b []byte) error {
+		return d.fs.WriteFile(name, b, d.filePerm)
+	}}, nil
+}
+
+// openFile opens a file for reading. FileSystems without a method
+// Open(name string) (io.ReadCloser, error) have it read in full instead.
+func (d *Driver) openFile(name string) (io.ReadCloser, error) {
+	var f io.ReadCloser
+
+	err := d.retry(func() (err error) {
+		if o, ok := d.fs.(interface {
+			Open(name string) (io.ReadCloser, error)
+		}); ok {
+			f, err = o.Open(name)
+			return err
+		}
+
+		b, err := d.fs.ReadFile(name)
+		f = io.NopCloser(bytes.NewReader(b))
+
+		return err
+	})
+
+	return f, err
+}
+
+type bufferedFile struct {
+	bytes.Buffer
+	write func(b []byte) error
+}
+
+func (f *bufferedFile) Close() error {
+	return f.write(f.Bytes())
+}
+
+// gzipFile is a decompressing reader over a file, closing both.
+type gzipFile struct {
+	*gzip.Reader
+	f io.Closer
+}
+
+func (g gzipFile) Close() error {
+	g.Reader.Close()
+	return g.f.Close()
+}
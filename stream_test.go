@@ -0,0 +1,127 @@
+package minidb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestWriteStream(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(d *Driver) error
+		record string
+		want   error
+	}{
+		{"plain", nil, `{"Name":"john"}`, nil},
+		{"schema", func(d *Driver) error {
+			return d.SetSchema("users", []byte(`{"type":"object","required":["Name"]}`))
+		}, `{}`, errors.ErrUnsupported},
+		{"index", func(d *Driver) error { return d.CreateIndex("users", "Name") }, `{"Name":"john"}`, errors.ErrUnsupported},
+		{"under limit", func(d *Driver) error {
+			n := 16
+			return d.ConfigureCollection("users", CollectionOptions{MaxRecordBytes: &n})
+		}, `{"Name":"john"}`, nil},
+		{"over limit", func(d *Driver) error {
+			n := 8
+			return d.ConfigureCollection("users", CollectionOptions{MaxRecordBytes: &n})
+		}, `{"Name":"john"}`, ErrRecordTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDriver(t, nil)
+
+			if tt.setup != nil {
+				if err := tt.setup(d); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := d.WriteStream("users", "john", strings.NewReader(tt.record))
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("WriteStream = %v, want %v", err, tt.want)
+			}
+
+			if tt.want != nil {
+				if _, err := d.ReadBytes("users", "john"); !errors.Is(err, ErrNotFound) {
+					t.Errorf("ReadBytes after a rejected stream = %v, want ErrNotFound", err)
+				}
+
+				tmp, _ := filepath.Glob(filepath.Join(d.dir, "users", "*.tmp"))
+				if len(tmp) > 0 {
+					t.Errorf("staged files left behind: %v", tmp)
+				}
+
+				return
+			}
+
+			rc, err := d.ReadStream("users", "john")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+
+			if b, _ := io.ReadAll(rc); string(b) != tt.record {
+				t.Errorf("ReadStream = %q, want %q", b, tt.record)
+			}
+		})
+	}
+}
+
+func TestWriteStreamCompressed(t *testing.T) {
+	d := newTestDriver(t, &Options{Compress: true})
+
+	if err := d.WriteStream("users", "john", strings.NewReader(`{"Name":"john"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(d.dir, "users", "john.json.gz")); err != nil {
+		t.Fatal(err)
+	}
+
+	var u user
+	if err := d.Read("users", "john", &u); err != nil || u.Name != "john" {
+		t.Errorf("Read = %+v, %v", u, err)
+	}
+}
+
+func TestWriteStreamEncrypted(t *testing.T) {
+	d := newTestDriver(t, &Options{EncryptionKey: bytes.Repeat([]byte{3}, 32)})
+
+	if err := d.WriteStream("users", "john", strings.NewReader(`{"Name":"john"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	var u user
+	if err := d.Read("users", "john", &u); err != nil || u.Name != "john" {
+		t.Errorf("Read = %+v, %v", u, err)
+	}
+
+	if err := d.WriteStream("users", "jane", iotest.ErrReader(errors.New("boom"))); err == nil {
+		t.Error("WriteStream from a failing reader succeeded")
+	}
+}
+
+func TestWriteStreamHooks(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	var got []string
+	d.Subscribe(Hooks{OnWrite: func(collection, resource string, raw []byte) {
+		got = append(got, resource+" "+string(raw))
+	}})
+
+	if err := d.WriteStream("users", "john", strings.NewReader(`{"Name":"john"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{`john {"Name":"john"}`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OnWrite got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+package minidb
+
+import "context"
+
+// Tracer starts a span for every call to the methods writing, reading or
+// deleting a record or reading a whole collection: WriteContext, ReadContext,
+// ReadAllContext, DeleteContext and the methods built on them, such as Write,
+// as well as WriteWithTTL, WriteWithTimeout, ReadBytes, ReadAllWithKeys,
+// ReadAllSince, Update, Upsert, Increment, MergePatch, WriteRaw, ReadRaw,
+// DeleteRaw, WriteStream and ReadStream, whose span ends once the record is
+// opened. It is small enough to adapt OpenTelemetry or any other tracing
+// library to. attributes hold the collection and, where there is one, the
+// resource. The returned func ends the span with the error the call failed
+// with, or nil.
+type Tracer interface {
+	StartSpan(ctx context.Context, name string, attributes map[string]string) (context.Context, func(err error))
+}
+
+// instrument starts a span named after op with the configured Tracer, if any,
+// and returns the func to call with the outcome once op is done, which also
+// logs op if it took longer than SlowThreshold.
+func (d *Driver) instrument(ctx context.Context, op, collection, resource string) (context.Context, func(error)) {
+	start := d.clock.Now()
+
+	end := func(error) {}
+
+	if d.tracer != nil {
+		attributes := map[string]string{"collection": collection}
+		if resource != "" {
+			attributes["resource"] = resource
+		}
+
+		ctx, end = d.tracer.StartSpan(ctx, "minidb."+op, attributes)
+	}
+
+	if d.slowThreshold <= 0 {
+		return ctx, end
+	}
+
+	return ctx, func(err error) {
+		end(err)
+
+		if elapsed := d.clock.Now().Sub(start); elapsed > d.slowThreshold {
+			d.log.Warn("Slow %s of '%s/%s': took %s\n", op, collection, resource, elapsed)
+		}
+	}
+}
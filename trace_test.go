@@ -0,0 +1,172 @@
+package minidb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTracer keeps a line for every span it ends.
+type recordingTracer struct {
+	mutex sync.Mutex
+	spans []string
+}
+
+func (tr *recordingTracer) StartSpan(ctx context.Context, name string, attributes map[string]string) (context.Context, func(err error)) {
+	return ctx, func(err error) {
+		tr.mutex.Lock()
+		defer tr.mutex.Unlock()
+
+		tr.spans = append(tr.spans, fmt.Sprintf("%s %s/%s %v", name, attributes["collection"], attributes["resource"], err != nil))
+	}
+}
+
+// recordingLogger keeps the warnings it's given.
+type recordingLogger struct {
+	quietLogger
+
+	mutex    sync.Mutex
+	warnings []string
+}
+
+func (l *recordingLogger) Warn(format string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+// slowFS is the os FileSystem taking delay longer to read, write, remove or
+// open a file.
+type slowFS struct {
+	osFS
+	delay time.Duration
+}
+
+func (f slowFS) ReadFile(name string) ([]byte, error) {
+	time.Sleep(f.delay)
+	return f.osFS.ReadFile(name)
+}
+
+func (f slowFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	time.Sleep(f.delay)
+	return f.osFS.WriteFile(name, data, perm)
+}
+
+func (f slowFS) Remove(name string) error {
+	time.Sleep(f.delay)
+	return f.osFS.Remove(name)
+}
+
+func (f slowFS) Open(name string) (io.ReadCloser, error) {
+	time.Sleep(f.delay)
+	return f.osFS.Open(name)
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	d := newTestDriver(t, &Options{Tracer: tracer})
+
+	d.Write("users", "john", user{})
+	d.Read("users", "john", &user{})
+	d.Read("users", "jane", &user{})
+	d.ReadAll("users")
+	d.Delete("users", "john")
+
+	want := []string{
+		"minidb.Write users/john false",
+		"minidb.Read users/john false",
+		"minidb.Read users/jane true",
+		"minidb.ReadAll users/ false",
+		"minidb.Delete users/john false",
+	}
+
+	if !reflect.DeepEqual(tracer.spans, want) {
+		t.Errorf("spans = %q, want %q", tracer.spans, want)
+	}
+}
+
+func TestTracerSeesErrors(t *testing.T) {
+	tracer := &recordingTracer{}
+	d := newTestDriver(t, &Options{Tracer: tracer})
+
+	if err := d.WriteContext(context.Background(), "users", "../x", user{}); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("WriteContext = %v, want ErrInvalidName", err)
+	}
+
+	if want := []string{"minidb.Write users/../x true"}; !reflect.DeepEqual(tracer.spans, want) {
+		t.Errorf("spans = %q, want %q", tracer.spans, want)
+	}
+}
+
+func TestSlowThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		slow      bool
+	}{
+		{"off", 0, false},
+		{"fast", time.Hour, false},
+		{"slow", time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := &recordingLogger{}
+			d := newTestDriver(t, &Options{Logger: log, SlowThreshold: tt.threshold, FileSystem: slowFS{delay: 5 * time.Millisecond}})
+
+			var u user
+
+			ops := []struct {
+				op  string
+				run func() error
+			}{
+				{"Write", func() error { return d.Write("users", "john", user{}) }},
+				{"Write", func() error { return d.WriteWithTTL("users", "john", user{}, time.Hour) }},
+				{"Write", func() error { return d.WriteWithTimeout("users", "john", user{}, time.Minute) }},
+				{"Update", func() error { return d.Update("users", "john", func(raw []byte) ([]byte, error) { return raw, nil }) }},
+				{"Upsert", func() error { return d.Upsert("users", "john", map[string]interface{}{"Age": 1}) }},
+				{"Increment", func() error { _, err := d.Increment("users", "john", "Age", 1); return err }},
+				{"MergePatch", func() error { return d.MergePatch("users", "john", []byte(`{"Age": 2}`)) }},
+				{"Read", func() error { return d.Read("users", "john", &u) }},
+				{"Read", func() error { _, err := d.ReadBytes("users", "john"); return err }},
+				{"WriteRaw", func() error { return d.WriteRaw("users", "john", []byte("x"), ".bin") }},
+				{"ReadRaw", func() error { _, err := d.ReadRaw("users", "john", ".bin"); return err }},
+				{"DeleteRaw", func() error { return d.DeleteRaw("users", "john", ".bin") }},
+				{"WriteStream", func() error { return d.WriteStream("users", "john", strings.NewReader("{}")) }},
+				{"ReadStream", func() error {
+					rc, err := d.ReadStream("users", "john")
+					if err == nil {
+						rc.Close()
+					}
+					return err
+				}},
+				{"Delete", func() error { return d.Delete("users", "john") }},
+			}
+
+			for _, o := range ops {
+				log.warnings = nil
+
+				if err := o.run(); err != nil {
+					t.Fatalf("%s: %v", o.op, err)
+				}
+
+				var slow bool
+				for _, w := range log.warnings {
+					slow = slow || strings.HasPrefix(w, "Slow "+o.op+" of 'users/john'")
+				}
+
+				if slow != tt.slow {
+					t.Errorf("%s: warnings %q, want slow %v", o.op, log.warnings, tt.slow)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package minidb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// trashDir is the hidden directory, at the root of the database, that
+// SoftDelete moves deleted records into, with a subdirectory per collection.
+const trashDir = ".trash"
+
+// trash moves the record file at path, along with its metadata, into the
+// trash, replacing whatever was trashed under the same name before.
+func (d *Driver) trash(collection, resource, path string) error {
+	dir := filepath.Join(d.dir, trashDir, collection)
+
+	if err := d.fs.MkdirAll(dir, d.dirPerm); err != nil {
+		return err
+	}
+
+	for _, name := range []string{resource + d.extFor(collection), resource + d.extFor(collection) + ".gz", resource + metaExt} {
+		if err := d.fs.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := d.fs.Rename(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+		return err
+	}
+
+	if err := d.fs.Rename(d.metaPath(collection, resource), filepath.Join(dir, resource+metaExt)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Undelete moves a record deleted with SoftDelete out of the trash, back into
+// its collection, along with its TTL and version. It fails with ErrExists if
+// the record has been written again since, and with ErrNotFound if it isn't
+// in the trash.
+func (d *Driver) Undelete(collection, resource string) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	if collection == "" {
+		return missingName("Missing collection - no place to restore record!")
+	}
+
+	if resource == "" {
+		return missingName("Missing resource - unable to restore record (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return err
+	}
+
+	resource = d.canonical(resource)
+
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	unlock, err := d.lockRecord(context.Background(), collection, resource)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, _, err := d.recordFile(collection, resource); err == nil {
+		return fmt.Errorf("unable to restore record %s: %w", resource, ErrExists)
+	}
+
+	dir := filepath.Join(d.dir, trashDir, collection)
+
+	var trashed string
+
+	for _, name := range []string{resource + d.extFor(collection), resource + d.extFor(collection) + ".gz"} {
+		if _, err := d.fs.Stat(filepath.Join(dir, name)); err == nil {
+			trashed = filepath.Join(dir, name)
+			break
+		}
+	}
+
+	if trashed == "" {
+		return fmt.Errorf("unable to find record %s in the trash: %w", resource, ErrNotFound)
+	}
+
+	b, err := d.readFile(trashed)
+	if err != nil {
+		return err
+	}
+
+	d.indexMutex.Lock()
+	defer d.indexMutex.Unlock()
+
+	index, err := d.updateIndexes(collection, map[string][]byte{resource: b})
+	if err != nil {
+		return err
+	}
+
+	shard := d.shard(filepath.Join(d.dir, collection), resource)
+
+	if err := d.fs.MkdirAll(shard, d.dirPerm); err != nil {
+		return err
+	}
+
+	// Whatever is left of the record is expired, and goes.
+	d.fs.Remove(filepath.Join(shard, resource+d.extFor(collection)))
+	d.fs.Remove(filepath.Join(shard, resource+d.extFor(collection)+".gz"))
+	d.fs.Remove(d.metaPath(collection, resource))
+
+	if err := d.fs.Rename(trashed, filepath.Join(shard, filepath.Base(trashed))); err != nil {
+		return err
+	}
+
+	if err := d.fs.Rename(filepath.Join(dir, resource+metaExt), d.metaPath(collection, resource)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	d.cache.remove(cacheKey(collection, resource))
+	pending.write(collection, resource, b)
+
+	if index != nil {
+		return index(resource)
+	}
+
+	return nil
+}
+
+// EmptyTrash permanently removes every record deleted with SoftDelete.
+func (d *Driver) EmptyTrash() error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+
+	if d.readOnly {
+		return ErrReadOnly
+	}
+
+	dir := filepath.Join(d.dir, trashDir)
+
+	entries, err := d.fs.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	collections := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		collections = append(collections, entry.Name())
+	}
+
+	unlock := d.lockCollections(collections...)
+	defer unlock()
+
+	return d.fs.RemoveAll(dir)
+}
@@ -0,0 +1,62 @@
+package minidb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSoftDelete(t *testing.T) {
+	d := newTestDriver(t, &Options{SoftDelete: true})
+
+	if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Delete("users", "john"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The trash isn't a collection of its own to write to or list.
+	if err := d.Write(trashDir, "john", user{}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Write(%q) = %v, want ErrInvalidName", trashDir, err)
+	}
+
+	if collections, _ := d.Collections(); len(collections) != 1 || collections[0] != "users" {
+		t.Errorf("Collections = %v, want [users]", collections)
+	}
+
+	if err := d.Undelete("users", "john"); err != nil {
+		t.Fatal(err)
+	}
+
+	var u user
+	if err := d.Read("users", "john", &u); err != nil || u.Name != "john" {
+		t.Errorf("Read after Undelete = %+v, %v", u, err)
+	}
+
+	tests := []struct {
+		name string
+		op   func() error
+		want error
+	}{
+		{"undelete live record", func() error {
+			d.Delete("users", "john")
+			d.Write("users", "john", user{})
+			return d.Undelete("users", "john")
+		}, ErrExists},
+		{"undelete after EmptyTrash", func() error {
+			d.Delete("users", "john")
+			if err := d.EmptyTrash(); err != nil {
+				return err
+			}
+			return d.Undelete("users", "john")
+		}, ErrNotFound},
+		{"undelete unknown", func() error { return d.Undelete("users", "nobody") }, ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		if err := tt.op(); !errors.Is(err, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
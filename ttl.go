@@ -0,0 +1,171 @@
+package minidb
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// metaExt is the extension of the sidecar file kept next to a record that
+// holds its metadata, such as its expiry and version.
+const metaExt = ".meta"
+
+type recordMeta struct {
+	Expires *time.Time `json:"expires,omitempty"`
+	Version int        `json:"version,omitempty"`
+}
+
+// setTTL sets the expiry to ttl from now, or clears it if ttl is not positive.
+func (m *recordMeta) setTTL(ttl time.Duration, now time.Time) {
+	m.Expires = nil
+
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		m.Expires = &expires
+	}
+}
+
+// bump advances the version of a versioned record; records that were never
+// written through WriteIfVersion stay unversioned.
+func (m *recordMeta) bump() {
+	if m.Version > 0 {
+		m.Version++
+	}
+}
+
+func (d *Driver) metaPath(collection, resource string) string {
+	return filepath.Join(d.shard(filepath.Join(d.dir, collection), resource), resource+metaExt)
+}
+
+func (d *Driver) readMeta(path string) (recordMeta, error) {
+	var meta recordMeta
+
+	b, err := d.fs.ReadFile(path)
+	if err != nil {
+		return meta, err
+	}
+
+	return meta, json.Unmarshal(b, &meta)
+}
+
+// updateMeta applies fn to a record's metadata and saves the result.
+func (d *Driver) updateMeta(collection, resource string, fn func(m *recordMeta)) error {
+	meta, err := d.readMeta(d.metaPath(collection, resource))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	fn(&meta)
+
+	return d.saveMeta(collection, resource, meta)
+}
+
+// saveMeta saves a record's metadata, removing the sidecar file once there is
+// nothing left in it.
+func (d *Driver) saveMeta(collection, resource string, meta recordMeta) error {
+	path := d.metaPath(collection, resource)
+
+	if meta == (recordMeta{}) {
+		if err := d.fs.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	return d.writeFile(path, b)
+}
+
+// expired reports whether the record in the collection directory dir has
+// outlived its TTL. Expiry is checked on every read, which treats expired
+// records as missing; they stay on disk until PurgeExpired sweeps them.
+func (d *Driver) expired(dir, resource string) bool {
+	meta, err := d.readMeta(filepath.Join(d.shard(dir, resource), resource+metaExt))
+	if err != nil || meta.Expires == nil {
+		return false
+	}
+
+	return !d.clock.Now().Before(*meta.Expires)
+}
+
+// PurgeExpired deletes the expired records of a collection and returns how
+// many were removed. OnDelete hooks are called for each of them.
+func (d *Driver) PurgeExpired(collection string) (int, error) {
+	if d.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	if collection == "" {
+		return 0, missingName("Missing collection - no place to purge records!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return 0, err
+	}
+
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	files, err := d.collectionFiles(dir)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	var purged []string
+
+	// Drop whatever was removed from the indexes, even if purging fails.
+	defer func() {
+		if len(purged) > 0 {
+			if err := d.unindex(collection, purged...); err != nil {
+				d.log.Error("Unable to update indexes of %s: %s\n", collection, err)
+			}
+		}
+	}()
+
+	for _, file := range files {
+		if !strings.HasSuffix(file, metaExt) {
+			continue
+		}
+
+		resource := strings.TrimSuffix(filepath.Base(file), metaExt)
+
+		if !d.expired(dir, resource) {
+			continue
+		}
+
+		path := filepath.Join(d.shard(dir, resource), resource+d.extFor(collection))
+		d.cache.remove(cacheKey(collection, resource))
+
+		for _, record := range []string{path, path + ".gz"} {
+			if err := d.fs.Remove(record); err != nil && !os.IsNotExist(err) {
+				return len(purged), err
+			}
+		}
+
+		if err := d.fs.Remove(filepath.Join(dir, file)); err != nil {
+			return len(purged), err
+		}
+
+		purged = append(purged, resource)
+		pending.delete(collection, resource)
+		d.counters.deletes.Add(1)
+	}
+
+	return len(purged), nil
+}
@@ -0,0 +1,153 @@
+package minidb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		ttl     time.Duration
+		advance time.Duration
+		expired bool
+	}{
+		{"not yet", Options{}, time.Hour, 59 * time.Minute, false},
+		{"at expiry", Options{}, time.Hour, time.Hour, true},
+		{"past expiry", Options{}, time.Hour, 2 * time.Hour, true},
+		{"no ttl", Options{}, 0, 100 * time.Hour, false},
+		{"default ttl", Options{TTL: time.Minute}, -1, time.Minute, true},
+		{"cached", Options{CacheSize: 10}, time.Hour, time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			tt.opts.Clock = clock
+			d := newTestDriver(t, &tt.opts)
+
+			var err error
+			if tt.ttl < 0 {
+				err = d.Write("sessions", "abc", user{Name: "john"})
+			} else {
+				err = d.WriteWithTTL("sessions", "abc", user{Name: "john"}, tt.ttl)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Prime the cache, if there is one.
+			var u user
+			if err := d.Read("sessions", "abc", &u); err != nil {
+				t.Fatal(err)
+			}
+
+			clock.Advance(tt.advance)
+
+			err = d.Read("sessions", "abc", &u)
+			if tt.expired && !errors.Is(err, ErrNotFound) || !tt.expired && err != nil {
+				t.Errorf("Read = %v, expired %v", err, tt.expired)
+			}
+
+			if exists, _ := d.Exists("sessions", "abc"); exists == tt.expired {
+				t.Errorf("Exists = %v, expired %v", exists, tt.expired)
+			}
+
+			if records, _ := d.ReadAll("sessions"); len(records) == 0 != tt.expired {
+				t.Errorf("ReadAll = %d records, expired %v", len(records), tt.expired)
+			}
+
+			purged, err := d.PurgeExpired("sessions")
+			if err != nil || purged == 1 != tt.expired {
+				t.Errorf("PurgeExpired = %d, %v; expired %v", purged, err, tt.expired)
+			}
+		})
+	}
+}
+
+func TestTTLRewrite(t *testing.T) {
+	clock := newFakeClock()
+	d := newTestDriver(t, &Options{Clock: clock})
+
+	if err := d.WriteWithTTL("sessions", "abc", user{}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writing without a TTL clears the expiry.
+	if err := d.Write("sessions", "abc", user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(2 * time.Hour)
+
+	if exists, err := d.Exists("sessions", "abc"); err != nil || !exists {
+		t.Errorf("Exists = %v, %v; a rewrite must clear the expiry", exists, err)
+	}
+
+	// An expired record can be written again.
+	if err := d.WriteWithTTL("sessions", "abc", user{}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Hour)
+
+	if err := d.WriteWithTTL("sessions", "abc", user{Name: "new"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	var u user
+	if err := d.Read("sessions", "abc", &u); err != nil || u.Name != "new" {
+		t.Errorf("Read = %+v, %v", u, err)
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	clock := newFakeClock()
+	d := newTestDriver(t, &Options{Clock: clock, ShardDepth: 1})
+
+	if err := d.AddUniqueIndex("sessions", "Name"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.CreateIndex("sessions", "Age"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, ttl := range map[string]time.Duration{"a": time.Minute, "b": time.Hour, "c": 0} {
+		if err := d.WriteWithTTL("sessions", name, user{Name: name}, ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clock.Advance(time.Minute)
+
+	if n, err := d.PurgeExpired("sessions"); err != nil || n != 1 {
+		t.Fatalf("PurgeExpired = %d, %v; want 1", n, err)
+	}
+
+	if n, err := d.Count("sessions"); err != nil || n != 2 {
+		t.Errorf("Count = %d, %v; want 2", n, err)
+	}
+
+	if found, _ := d.FindByField("sessions", "Age", 0); len(found) != 2 {
+		t.Errorf("FindByField = %v, the purged record must leave the index", found)
+	}
+
+	if problems, err := d.CheckIndexes("sessions"); err != nil || len(problems) > 0 {
+		t.Errorf("CheckIndexes = %v, %v", problems, err)
+	}
+
+	if err := d.Write("sessions", "d", user{Name: "a"}); err != nil {
+		t.Errorf("Write = %v, the purged record must leave the index", err)
+	}
+
+	if n, err := d.PurgeExpired("sessions"); err != nil || n != 0 {
+		t.Errorf("second PurgeExpired = %d, %v; want 0", n, err)
+	}
+
+	if _, err := d.PurgeExpired("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("PurgeExpired(missing) = %v, want ErrNotFound", err)
+	}
+}
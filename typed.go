@@ -0,0 +1,143 @@
+package minidb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errStop ends an Each early once the record looked for has been found.
+var errStop = errors.New("stop")
+
+// Collection is a typed view over a single collection of a Driver. It goes
+// through the Driver for every operation, so it shares the Driver's locks with
+// untyped access to the same collection.
+type Collection[T any] struct {
+	d    *Driver
+	name string
+}
+
+func Typed[T any](d *Driver, name string) *Collection[T] {
+	return &Collection[T]{d: d, name: name}
+}
+
+func (c *Collection[T]) Get(resource string) (T, error) {
+	var v T
+
+	if err := c.d.Read(c.name, resource, &v); err != nil {
+		return v, err
+	}
+
+	return v, nil
+}
+
+func (c *Collection[T]) Put(resource string, v T) error {
+	return c.d.Write(c.name, resource, v)
+}
+
+func (c *Collection[T]) All() ([]T, error) {
+	records, err := c.d.ReadAll(c.name)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]T, 0, len(records))
+
+	for _, record := range records {
+		var v T
+
+		if err := c.d.codec.Unmarshal([]byte(record), &v); err != nil {
+			return nil, err
+		}
+
+		all = append(all, v)
+	}
+
+	return all, nil
+}
+
+func (c *Collection[T]) AllMap() (map[string]T, error) {
+	return AllMap[T](c.d, c.name)
+}
+
+// AllMap decodes every record of a collection into a map keyed by record
+// name. A record that fails to decode aborts it.
+func AllMap[T any](d *Driver, collection string) (map[string]T, error) {
+	records, err := d.ReadAllWithKeys(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(map[string]T, len(records))
+
+	for resource, record := range records {
+		var v T
+
+		if err := d.codec.Unmarshal([]byte(record), &v); err != nil {
+			return nil, fmt.Errorf("unable to decode record %s: %w", resource, err)
+		}
+
+		all[resource] = v
+	}
+
+	return all, nil
+}
+
+func (c *Collection[T]) FindFirst(match func(T) bool) (T, string, bool, error) {
+	return FindFirst(c.d, c.name, match)
+}
+
+// FindFirst decodes the records of a collection one at a time, in name order,
+// and returns the first one match accepts along with its name. Records after it
+// are never read. found is false if no record matches.
+func FindFirst[T any](d *Driver, collection string, match func(T) bool) (v T, resource string, found bool, err error) {
+	err = d.Each(collection, func(name string, raw []byte) error {
+		var record T
+
+		if err := d.codec.Unmarshal(raw, &record); err != nil {
+			return fmt.Errorf("unable to decode record %s: %w", name, err)
+		}
+
+		if !match(record) {
+			return nil
+		}
+
+		v, resource, found = record, name, true
+
+		return errStop
+	})
+
+	if errors.Is(err, errStop) {
+		err = nil
+	}
+
+	return v, resource, found, err
+}
+
+func (c *Collection[T]) Query(match func(T) bool) ([]T, error) {
+	return QueryTyped(c.d, c.name, match)
+}
+
+// QueryTyped decodes every record of a collection, in name order, and returns
+// those match accepts. A record that fails to decode aborts the query.
+func QueryTyped[T any](d *Driver, collection string, match func(T) bool) ([]T, error) {
+	matches := []T{}
+
+	err := d.Each(collection, func(name string, raw []byte) error {
+		var record T
+
+		if err := d.codec.Unmarshal(raw, &record); err != nil {
+			return fmt.Errorf("unable to decode record %s: %w", name, err)
+		}
+
+		if match(record) {
+			matches = append(matches, record)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
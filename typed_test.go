@@ -0,0 +1,67 @@
+package minidb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTyped(t *testing.T) {
+	d := newTestDriver(t, nil)
+	users := Typed[user](d, "users")
+
+	for _, u := range []user{{Name: "john", Age: 30}, {Name: "jane", Age: 25}, {Name: "bob", Age: 40}} {
+		if err := users.Put(u.Name, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if u, err := users.Get("jane"); err != nil || u.Age != 25 {
+		t.Errorf("Get = %+v, %v", u, err)
+	}
+
+	if _, err := users.Get("nobody"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(nobody) = %v, want ErrNotFound", err)
+	}
+
+	if all, err := users.All(); err != nil || len(all) != 3 || all[0].Name != "bob" {
+		t.Errorf("All = %+v, %v", all, err)
+	}
+
+	all, err := users.AllMap()
+	if err != nil || len(all) != 3 || all["john"].Age != 30 {
+		t.Errorf("AllMap = %+v, %v", all, err)
+	}
+
+	u, resource, found, err := users.FindFirst(func(u user) bool { return u.Age < 35 })
+	if err != nil || !found || resource != "jane" || u.Name != "jane" {
+		t.Errorf("FindFirst = %+v, %s, %v, %v", u, resource, found, err)
+	}
+
+	if _, _, found, err := users.FindFirst(func(u user) bool { return false }); found || err != nil {
+		t.Errorf("FindFirst of nothing = %v, %v", found, err)
+	}
+
+	matches, err := users.Query(func(u user) bool { return u.Age >= 30 })
+	if want := []user{{Name: "bob", Age: 40}, {Name: "john", Age: 30}}; err != nil || !reflect.DeepEqual(matches, want) {
+		t.Errorf("Query = %+v, %v; want %+v", matches, err, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(d.dir, "users", "bad.json"), []byte(`{"Age": "old"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := AllMap[user](d, "users"); err == nil {
+		t.Error("AllMap decoded a bad record")
+	}
+
+	if _, err := QueryTyped(d, "users", func(u user) bool { return true }); err == nil {
+		t.Error("QueryTyped decoded a bad record")
+	}
+
+	if _, err := AllMap[user](d, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AllMap(missing) = %v, want ErrNotFound", err)
+	}
+}
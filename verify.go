@@ -0,0 +1,93 @@
+package minidb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Verify reads every record of a collection and returns the names of those
+// that can't be decoded, such as files truncated by a crash or mangled by hand.
+// Records that fail to decrypt or decompress count as corrupt too. GobCodec
+// can't decode a record without knowing its type, so with it only decryption
+// and decompression are checked. Only errors reaching the files at all abort
+// the check.
+func (d *Driver) Verify(collection string) ([]string, error) {
+	if d.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	if collection == "" {
+		return nil, missingName("Missing collection - nothing to verify!")
+	}
+
+	if err := d.validateName(collection); err != nil {
+		return nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	dir := filepath.Join(d.dir, collection)
+
+	if _, err := d.stat(collection, dir); err != nil {
+		return nil, notFound(err)
+	}
+
+	files, err := d.listRecords(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	var corrupt []string
+
+	for _, file := range files {
+		b, err := d.readFile(filepath.Join(dir, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			return nil, err
+		}
+
+		if _, gob := d.codec.(GobCodec); err == nil && !gob {
+			var v interface{}
+			err = d.codec.Unmarshal(b, &v)
+		}
+
+		if err != nil {
+			corrupt = append(corrupt, d.recordName(collection, file))
+		}
+	}
+
+	return corrupt, nil
+}
+
+// VerifyAll runs Verify over every collection, returning the corrupt records
+// of each collection that has any.
+func (d *Driver) VerifyAll() (map[string][]string, error) {
+	collections, err := d.Collections()
+	if err != nil {
+		return nil, err
+	}
+
+	corrupt := map[string][]string{}
+
+	for _, collection := range collections {
+		resources, err := d.Verify(collection)
+		if err != nil {
+			return nil, fmt.Errorf("unable to verify collection %s: %w", collection, err)
+		}
+
+		if len(resources) > 0 {
+			corrupt[collection] = resources
+		}
+	}
+
+	return corrupt, nil
+}
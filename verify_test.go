@@ -0,0 +1,84 @@
+package minidb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *Options
+		ext  string
+
+		// mangle is written over the record "bad".
+		mangle []byte
+	}{
+		{"json", nil, ".json", []byte(`{"Name":`)},
+		{"yaml", &Options{Codec: YAMLCodec{}}, ".yaml", []byte("Name: [")},
+		{"gob", &Options{Codec: GobCodec{}}, ".gob", nil},
+		{"compressed", &Options{Compress: true}, ".json.gz", []byte("not gzip")},
+		{"encrypted", &Options{EncryptionKey: bytes.Repeat([]byte{7}, 16)}, ".json", []byte("not sealed")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDriver(t, tt.opts)
+
+			for _, name := range []string{"good", "bad"} {
+				if err := d.Write("users", name, user{Name: name}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var want []string
+
+			if tt.mangle != nil {
+				if err := os.WriteFile(filepath.Join(d.dir, "users", "bad"+tt.ext), tt.mangle, 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				want = []string{"bad"}
+			}
+
+			corrupt, err := d.Verify("users")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(corrupt, want) {
+				t.Errorf("Verify = %v, want %v", corrupt, want)
+			}
+		})
+	}
+}
+
+func TestVerifyAll(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	for _, collection := range []string{"users", "orders"} {
+		for _, name := range []string{"good", "bad"} {
+			if err := d.Write(collection, name, user{Name: name}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := d.Write("admins", "root", user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, collection := range []string{"users", "orders"} {
+		if err := os.WriteFile(filepath.Join(d.dir, collection, "bad.json"), []byte("{"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := d.VerifyAll()
+	if want := map[string][]string{"users": {"bad"}, "orders": {"bad"}}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("VerifyAll = %v, %v; want %v", got, err, want)
+	}
+}
@@ -0,0 +1,141 @@
+package minidb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var ErrVersionMismatch = errors.New("record version mismatch")
+
+// WriteIfVersion writes a record only if its stored version still equals
+// expectedVersion, and returns the version it was stored under. Records that
+// don't exist yet, or were never versioned, are at version 0. Once versioned,
+// every later write to the record, through any method, advances its version.
+func (d *Driver) WriteIfVersion(collection, resource string, v interface{}, expectedVersion int) (int, error) {
+	if d.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	if d.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	if collection == "" {
+		return 0, missingName("Missing collection - no place to save record!")
+	}
+
+	if resource == "" {
+		return 0, missingName("Missing resource - unable to save record (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return 0, err
+	}
+
+	resource = d.canonical(resource)
+
+	pending := d.pendingHooks()
+	defer pending.run()
+
+	unlock, err := d.lockRecord(context.Background(), collection, resource)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	current, err := d.version(collection, resource)
+	if err != nil {
+		return 0, err
+	}
+
+	if current != expectedVersion {
+		return current, fmt.Errorf("%w: expected %d, found %d", ErrVersionMismatch, expectedVersion, current)
+	}
+
+	if err := d.fs.MkdirAll(filepath.Join(d.dir, collection), d.dirPerm); err != nil {
+		return 0, err
+	}
+
+	b, err := d.marshal(collection, v)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := d.writeRecord(collection, resource, b); err != nil {
+		return 0, err
+	}
+
+	err = d.updateMeta(collection, resource, func(m *recordMeta) {
+		m.setTTL(d.ttl, d.clock.Now())
+		m.Version = expectedVersion + 1
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	pending.write(collection, resource, b)
+
+	return expectedVersion + 1, nil
+}
+
+// ReadWithVersion is Read that also returns the record's current version.
+func (d *Driver) ReadWithVersion(collection, resource string, v interface{}) (int, error) {
+	if d.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	if collection == "" {
+		return 0, missingName("Missing collection - no place to read record!")
+	}
+
+	if resource == "" {
+		return 0, missingName("Missing resource - unable to read record (no name)!")
+	}
+
+	if err := d.validateName(collection, resource); err != nil {
+		return 0, err
+	}
+
+	resource = d.canonical(resource)
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	record, _, err := d.recordFile(collection, resource)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	b, err := d.readFile(record)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := d.codec.Unmarshal(b, v); err != nil {
+		return 0, err
+	}
+
+	return d.version(collection, resource)
+}
+
+// version returns the stored version of a record, which is 0 for records that
+// are missing, expired or unversioned.
+func (d *Driver) version(collection, resource string) (int, error) {
+	if _, _, err := d.recordFile(collection, resource); err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	meta, err := d.readMeta(d.metaPath(collection, resource))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	return meta.Version, nil
+}
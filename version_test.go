@@ -0,0 +1,59 @@
+package minidb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWriteIfVersion(t *testing.T) {
+	d := newTestDriver(t, nil)
+
+	tests := []struct {
+		name     string
+		op       func() (int, error)
+		want     int
+		mismatch bool
+	}{
+		{"create", func() (int, error) { return d.WriteIfVersion("users", "john", user{Age: 1}, 0) }, 1, false},
+		{"create again", func() (int, error) { return d.WriteIfVersion("users", "john", user{Age: 9}, 0) }, 1, true},
+		{"update", func() (int, error) { return d.WriteIfVersion("users", "john", user{Age: 2}, 1) }, 2, false},
+		{"stale", func() (int, error) { return d.WriteIfVersion("users", "john", user{Age: 9}, 1) }, 2, true},
+		{"plain write bumps", func() (int, error) { return 3, d.Write("users", "john", user{Age: 3}) }, 3, false},
+		{"after plain write", func() (int, error) { return d.WriteIfVersion("users", "john", user{Age: 4}, 3) }, 4, false},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.op()
+		if tt.mismatch != errors.Is(err, ErrVersionMismatch) || !tt.mismatch && err != nil || got != tt.want {
+			t.Fatalf("%s: got version %d, %v; want %d, mismatch %v", tt.name, got, err, tt.want, tt.mismatch)
+		}
+
+		var u user
+
+		version, err := d.ReadWithVersion("users", "john", &u)
+		if err != nil || version != tt.want || u.Age != tt.want {
+			t.Errorf("%s: ReadWithVersion = %d, %+v, %v; want %d", tt.name, version, u, err, tt.want)
+		}
+	}
+
+	if err := d.Write("users", "jane", user{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if version, err := d.ReadWithVersion("users", "jane", &user{}); err != nil || version != 0 {
+		t.Errorf("unversioned record at version %d, %v", version, err)
+	}
+
+	if _, err := d.ReadWithVersion("users", "nobody", &user{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadWithVersion(nobody) = %v, want ErrNotFound", err)
+	}
+
+	// Deleting a record resets its version.
+	if err := d.Delete("users", "john"); err != nil {
+		t.Fatal(err)
+	}
+
+	if version, err := d.WriteIfVersion("users", "john", user{}, 0); err != nil || version != 1 {
+		t.Errorf("WriteIfVersion after Delete = %d, %v; want 1", version, err)
+	}
+}
@@ -0,0 +1,132 @@
+package minidb
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// walFile is the write-ahead log, at the root of the database directory, that
+// WriteBatch records its renames in when Options.WAL is set.
+const walFile = "wal.log"
+
+// walBatch is what the write-ahead log holds about a batch whose records have
+// all been staged to ".tmp" files but not necessarily renamed into place yet.
+type walBatch struct {
+	Collection string      `json:"collection"`
+	Records    []walRecord `json:"records"`
+}
+
+type walRecord struct {
+	Resource string `json:"resource"`
+
+	// Path is where the record goes, relative to the database directory; its
+	// staged copy is at Path plus ".tmp".
+	Path string     `json:"path"`
+	Meta recordMeta `json:"meta"`
+}
+
+// logBatch durably records a batch in the write-ahead log.
+func (d *Driver) logBatch(batch walBatch) error {
+	b, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	return d.writeSynced(filepath.Join(d.dir, walFile), append(b, '\n'), d.filePerm)
+}
+
+// clearLog empties the write-ahead log once its batch has been dealt with.
+func (d *Driver) clearLog() error {
+	return d.fs.WriteFile(filepath.Join(d.dir, walFile), nil, d.filePerm)
+}
+
+// replayLog finishes a batch that was interrupted while its records were being
+// renamed into place. Every record was staged before the batch was logged, so
+// the batch can always be completed: staged files still around are renamed,
+// and the metadata of every record is set to what the batch meant it to be. A
+// log that can't be decoded was torn while being written, before the batch
+// committed, so the batch is discarded instead.
+func (d *Driver) replayLog() error {
+	b, err := d.fs.ReadFile(filepath.Join(d.dir, walFile))
+	if os.IsNotExist(err) || len(b) == 0 {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var batch walBatch
+
+	if err := json.Unmarshal(b, &batch); err != nil {
+		d.log.Warn("Discarding a batch torn while being logged to %s: %s \n", walFile, err)
+		return d.discardLog()
+	}
+
+	d.log.Info("Completing an interrupted batch of %d records in '%s' \n", len(batch.Records), batch.Collection)
+
+	for _, record := range batch.Records {
+		path := filepath.Join(d.dir, filepath.FromSlash(record.Path))
+
+		if err := d.fs.Rename(path+".tmp", path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		// Drop the copy in the other (compressed or uncompressed) format, as
+		// removeStale would have.
+		stale := path + ".gz"
+		if strings.HasSuffix(path, ".gz") {
+			stale = strings.TrimSuffix(path, ".gz")
+		}
+
+		if err := d.fs.Remove(stale); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := d.saveMeta(batch.Collection, record.Resource, record.Meta); err != nil {
+			return err
+		}
+	}
+
+	if err := d.rebuildIndexes(batch.Collection); err != nil {
+		return err
+	}
+
+	return d.clearLog()
+}
+
+// discardLog drops a batch that never committed: the files staged for it are
+// removed and the log is cleared. The torn log doesn't say which collection
+// the batch was for, so staged files are removed from every collection.
+func (d *Driver) discardLog() error {
+	collections, err := d.Collections()
+	if err != nil {
+		return err
+	}
+
+	for _, collection := range collections {
+		err := d.walkDir(filepath.Join(d.dir, collection), func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if entry.IsDir() || !strings.HasSuffix(path, ".tmp") {
+				return nil
+			}
+
+			if err := d.fs.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.clearLog()
+}
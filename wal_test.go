@@ -0,0 +1,123 @@
+package minidb
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplayLog(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+
+		// want is whether the staged record is expected in place after New.
+		want bool
+	}{
+		{"complete", `{"collection":"users","records":[{"resource":"jane","path":"users/jane.json","meta":{}}]}` + "\n", true},
+		{"torn", `{"collection":"users","records":[{"resource":"ja`, false},
+		{"garbage", "\x00\x00\x00", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			d, err := New(dir, &Options{WAL: true, Logger: quietLogger{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := d.Write("users", "john", user{Name: "john"}); err != nil {
+				t.Fatal(err)
+			}
+
+			d.Close()
+
+			staged := filepath.Join(dir, "users", "jane.json.tmp")
+			if err := os.WriteFile(staged, []byte(`{"Name":"jane"}`), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.WriteFile(filepath.Join(dir, walFile), []byte(tt.log), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			d, err = New(dir, &Options{WAL: true, Logger: quietLogger{}})
+			if err != nil {
+				t.Fatalf("New with a %s log: %v", tt.name, err)
+			}
+			defer d.Close()
+
+			if _, err := os.Stat(staged); !os.IsNotExist(err) {
+				t.Errorf("staged file left behind: %v", err)
+			}
+
+			if b, _ := os.ReadFile(filepath.Join(dir, walFile)); len(b) != 0 {
+				t.Errorf("log not cleared: %q", b)
+			}
+
+			var jane user
+			err = d.Read("users", "jane", &jane)
+			if tt.want && (err != nil || jane.Name != "jane") {
+				t.Errorf("Read(jane) = %+v, %v; want the replayed record", jane, err)
+			}
+
+			if !tt.want && !errors.Is(err, ErrNotFound) {
+				t.Errorf("Read(jane) = %v, want ErrNotFound for a discarded batch", err)
+			}
+
+			var john user
+			if err := d.Read("users", "john", &john); err != nil || john.Name != "john" {
+				t.Errorf("Read(john) = %+v, %v", john, err)
+			}
+		})
+	}
+}
+
+// walSnoopFS is the os FileSystem keeping what the write-ahead log held when
+// the first record was renamed into place.
+type walSnoopFS struct {
+	osFS
+
+	dir    string
+	logged []byte
+}
+
+func (f *walSnoopFS) Rename(oldpath, newpath string) error {
+	if f.logged == nil && strings.HasSuffix(oldpath, ".tmp") {
+		f.logged, _ = os.ReadFile(filepath.Join(f.dir, walFile))
+	}
+
+	return f.osFS.Rename(oldpath, newpath)
+}
+
+func TestWriteBatchLogs(t *testing.T) {
+	dir := t.TempDir()
+	fsys := &walSnoopFS{dir: dir}
+	d := newTestDriverAt(t, dir, &Options{WAL: true, FileSystem: fsys})
+
+	if err := d.WriteBatch("users", map[string]interface{}{"john": user{}, "jane": user{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var batch walBatch
+	if err := json.Unmarshal(fsys.logged, &batch); err != nil {
+		t.Fatalf("log during the renames = %q: %v", fsys.logged, err)
+	}
+
+	if batch.Collection != "users" || len(batch.Records) != 2 || batch.Records[0].Path != "users/jane.json" {
+		t.Errorf("logged batch = %+v", batch)
+	}
+
+	if b, err := os.ReadFile(filepath.Join(dir, walFile)); err != nil || len(b) > 0 {
+		t.Errorf("log after the batch = %q, %v; want it cleared", b, err)
+	}
+
+	if n, _ := d.Count("users"); n != 2 {
+		t.Errorf("Count = %d, want 2", n)
+	}
+}
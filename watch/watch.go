@@ -0,0 +1,205 @@
+// Package watch reports changes made to the records of a Driver's collection
+// by any process. It lives apart from the database package so that library
+// users don't depend on fsnotify.
+package watch
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	minidb "github.com/arnabry11/mini-database"
+)
+
+type ChangeType int
+
+const (
+	Created ChangeType = iota
+	Updated
+	Deleted
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case Created:
+		return "created"
+	case Updated:
+		return "updated"
+	case Deleted:
+		return "deleted"
+	}
+
+	return fmt.Sprintf("ChangeType(%d)", int(t))
+}
+
+type ChangeEvent struct {
+	Type       ChangeType
+	Collection string
+	Resource   string
+}
+
+// debounce is how long Watch waits for a record's file events to settle
+// before reporting the change.
+const debounce = 50 * time.Millisecond
+
+// Watch reports changes made to the records of a collection by any process,
+// including this one. File events are coalesced per record, so the write of
+// a ".tmp" file followed by its rename into place shows up as a single event.
+// Only databases on the default FileSystem can be watched. The returned func
+// stops watching and closes the channel.
+func Watch(d *minidb.Driver, collection string) (<-chan ChangeEvent, func(), error) {
+	keys, err := d.Keys(collection)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !d.Local() {
+		return nil, nil, fmt.Errorf("unable to watch collection %s: only the default FileSystem can be watched", collection)
+	}
+
+	dir := filepath.Join(d.Dir(), collection)
+	log := d.Logger()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := watchTree(watcher, dir); err != nil {
+		watcher.Close()
+		return nil, nil, err
+	}
+
+	known := make(map[string]bool, len(keys))
+
+	for _, key := range keys {
+		known[key] = true
+	}
+
+	events := make(chan ChangeEvent)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(events)
+
+		pending := map[string]bool{}
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn("Watching '%s' failed: %v\n", collection, err)
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				// A new shard directory needs watching too, and may
+				// already hold records written before the watch was added.
+				if ev.Op.Has(fsnotify.Create) && !strings.HasPrefix(filepath.Base(ev.Name), ".") {
+					if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+						if err := watchTree(watcher, ev.Name); err != nil {
+							log.Warn("Watching '%s' failed: %v\n", collection, err)
+						}
+
+						filepath.WalkDir(ev.Name, func(path string, entry fs.DirEntry, err error) error {
+							if err == nil && !entry.IsDir() {
+								if resource, ok := d.RecordName(collection, entry.Name()); ok {
+									pending[resource] = true
+								}
+							}
+
+							return nil
+						})
+
+						timer.Reset(debounce)
+						continue
+					}
+				}
+
+				resource, ok := d.RecordName(collection, filepath.Base(ev.Name))
+				if ev.Op == fsnotify.Chmod || !ok {
+					continue
+				}
+
+				pending[resource] = true
+				timer.Reset(debounce)
+			case <-timer.C:
+				for resource := range pending {
+					exists, err := d.Exists(collection, resource)
+					if err != nil {
+						log.Warn("Watching '%s' failed: %v\n", collection, err)
+						continue
+					}
+
+					ev := ChangeEvent{Collection: collection, Resource: resource}
+
+					switch {
+					case exists && known[resource]:
+						ev.Type = Updated
+					case exists:
+						ev.Type = Created
+					case known[resource]:
+						ev.Type = Deleted
+					default:
+						continue
+					}
+
+					known[resource] = exists
+
+					select {
+					case events <- ev:
+					case <-done:
+						return
+					}
+				}
+
+				pending = map[string]bool{}
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	cancel := func() {
+		once.Do(func() {
+			close(done)
+			watcher.Close()
+		})
+	}
+
+	return events, cancel, nil
+}
+
+// watchTree adds dir to watcher along with the shard directories under it.
+// Directories starting with a dot hold the collection's bookkeeping rather
+// than records, so they're left out.
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		return watcher.Add(path)
+	})
+}
@@ -0,0 +1,120 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	minidb "github.com/arnabry11/mini-database"
+)
+
+type quietLogger struct{}
+
+func (quietLogger) Fatal(string, ...interface{}) {}
+func (quietLogger) Error(string, ...interface{}) {}
+func (quietLogger) Warn(string, ...interface{})  {}
+func (quietLogger) Info(string, ...interface{})  {}
+func (quietLogger) Debug(string, ...interface{}) {}
+func (quietLogger) Trace(string, ...interface{}) {}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+
+	d, err := minidb.New(dir, &minidb.Options{Logger: quietLogger{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if err := d.Write("users", "john", map[string]string{"name": "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, cancel, err := Watch(d, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	steps := []struct {
+		name   string
+		change func() error
+		want   ChangeEvent
+	}{
+		{"create", func() error { return d.Write("users", "jane", map[string]string{"name": "jane"}) }, ChangeEvent{Created, "users", "jane"}},
+		{"update", func() error { return d.Write("users", "john", map[string]string{"name": "johnny"}) }, ChangeEvent{Updated, "users", "john"}},
+		{"delete", func() error { return d.Delete("users", "jane") }, ChangeEvent{Deleted, "users", "jane"}},
+		{"external", func() error {
+			return os.WriteFile(filepath.Join(dir, "users", "bob.json"), []byte(`{"name":"bob"}`), 0644)
+		}, ChangeEvent{Created, "users", "bob"}},
+	}
+
+	for _, step := range steps {
+		if err := step.change(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		select {
+		case ev := <-events:
+			if ev != step.want {
+				t.Errorf("%s: got %+v, want %+v", step.name, ev, step.want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: no event", step.name)
+		}
+	}
+
+	cancel()
+
+	if _, ok := <-events; ok {
+		t.Error("events not closed by cancel")
+	}
+}
+
+// TestWatchSharded checks that records land in shard directories created
+// after the watch started are still reported.
+func TestWatchSharded(t *testing.T) {
+	d, err := minidb.New(t.TempDir(), &minidb.Options{Logger: quietLogger{}, ShardDepth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if err := d.Write("users", "john", map[string]string{"name": "john"}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, cancel, err := Watch(d, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+
+	if err := d.Write("users", "jane", map[string]string{"name": "jane"}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ev := <-events:
+		if want := (ChangeEvent{Created, "users", "jane"}); ev != want {
+			t.Errorf("got %+v, want %+v", ev, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event")
+	}
+}
+
+func TestWatchErrors(t *testing.T) {
+	d, err := minidb.New(t.TempDir(), &minidb.Options{Logger: quietLogger{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	for _, collection := range []string{"", "missing", "../users"} {
+		if _, _, err := Watch(d, collection); err == nil {
+			t.Errorf("Watch(%q) succeeded", collection)
+		}
+	}
+}